@@ -0,0 +1,14 @@
+package dagflow_debug
+
+type Config struct {
+	// RecentRuns is the number of run reports kept for each registered factory
+	RecentRuns int
+}
+
+var defaultConfig = Config{
+	RecentRuns: 100,
+}
+
+func GetDefaultConfig() Config {
+	return defaultConfig
+}
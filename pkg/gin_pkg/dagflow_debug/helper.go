@@ -0,0 +1,76 @@
+package dagflow_debug
+
+import (
+	"sort"
+	"time"
+
+	"github.com/Steve-Lee-CST/go-pico-tool/pkg/task_dagflow"
+)
+
+// FactorySummary is the overview of one registered factory
+type FactorySummary struct {
+	Name string `json:"name"`
+	// Version and TaskCount describe the current snapshot, both are 0 before the graph is created
+	Version        uint64 `json:"version"`
+	TaskCount      int    `json:"task_count"`
+	RunCount       int    `json:"run_count"`
+	FailedRunCount int    `json:"failed_run_count"`
+}
+
+// TaskFailure aggregates the failures of one task among recent runs
+type TaskFailure struct {
+	TaskName   string    `json:"task_name"`
+	OutputType string    `json:"output_type"`
+	Count      int       `json:"count"`
+	LastError  string    `json:"last_error"`
+	LastTime   time.Time `json:"last_time"`
+}
+
+type helper struct{}
+
+var Helper = helper{}
+
+// NewestFirst returns at most limit reports from the newest, limit <= 0 means no limit
+func (h helper) NewestFirst(reports []*task_dagflow.RunReport, limit int, status task_dagflow.RunStatus) []*task_dagflow.RunReport {
+	result := make([]*task_dagflow.RunReport, 0, len(reports))
+	for i := len(reports) - 1; i >= 0; i-- {
+		if limit > 0 && len(result) >= limit {
+			break
+		}
+		if status != "" && reports[i].Status != status {
+			continue
+		}
+		result = append(result, reports[i])
+	}
+	return result
+}
+
+// AggregateFailures counts failed tasks among reports, the most frequent first
+func (h helper) AggregateFailures(reports []*task_dagflow.RunReport) []TaskFailure {
+	failures := make(map[string]*TaskFailure)
+	for _, report := range reports {
+		for _, task := range report.FailedTasks() {
+			failure, ok := failures[task.Name]
+			if !ok {
+				failure = &TaskFailure{TaskName: task.Name, OutputType: task.OutputType}
+				failures[task.Name] = failure
+			}
+			failure.Count++
+			if !task.StartTime.Before(failure.LastTime) {
+				failure.LastTime = task.StartTime
+				failure.LastError = task.Error
+			}
+		}
+	}
+	result := make([]TaskFailure, 0, len(failures))
+	for _, failure := range failures {
+		result = append(result, *failure)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].TaskName < result[j].TaskName
+	})
+	return result
+}
@@ -0,0 +1,155 @@
+package dagflow_debug
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/Steve-Lee-CST/go-pico-tool/pkg/gin_pkg/common"
+	"github.com/Steve-Lee-CST/go-pico-tool/pkg/task_dagflow"
+	"github.com/Steve-Lee-CST/go-pico-tool/tools"
+	"github.com/gin-gonic/gin"
+)
+
+type factoryEntry struct {
+	factory task_dagflow.IFactory
+	runs    tools.RingBuffer[*task_dagflow.RunReport]
+}
+
+// DagflowDebug exposes registered factories, their graphs and recent runs over http,
+// similar to net/http/pprof but for task dagflows.
+type DagflowDebug struct {
+	config    Config
+	factories map[string]*factoryEntry
+	rwLock    sync.RWMutex
+}
+
+func NewDagflowDebug(config Config) *DagflowDebug {
+	if config.RecentRuns <= 0 {
+		config.RecentRuns = GetDefaultConfig().RecentRuns
+	}
+	return &DagflowDebug{
+		config:    config,
+		factories: make(map[string]*factoryEntry),
+	}
+}
+
+// Register starts recording runs of the factory, factory names should be unique
+func (d *DagflowDebug) Register(factory task_dagflow.IFactory) error {
+	d.rwLock.Lock()
+	defer d.rwLock.Unlock()
+	if _, exists := d.factories[factory.Name()]; exists {
+		return fmt.Errorf("factory %s already registered", factory.Name())
+	}
+	entry := &factoryEntry{
+		factory: factory,
+		runs:    tools.NewConcurrentRingBuffer[*task_dagflow.RunReport](d.config.RecentRuns),
+	}
+	factory.AddRunObserver(entry.runs.Push)
+	d.factories[factory.Name()] = entry
+	return nil
+}
+
+func (d *DagflowDebug) getEntry(name string) (*factoryEntry, bool) {
+	d.rwLock.RLock()
+	defer d.rwLock.RUnlock()
+	entry, ok := d.factories[name]
+	return entry, ok
+}
+
+// Mount registers the debug endpoints on the router group
+//
+//	GET /factories                   registered factories
+//	GET /factories/:name/graph       graph of the current snapshot in json
+//	GET /factories/:name/graph/dot   graph of the current snapshot in graphviz dot
+//	GET /factories/:name/runs        recent runs, newest first, query: limit, status
+//	GET /factories/:name/failures    failing tasks among recent runs
+//	GET /resources                   usage of task resource classes in the process
+func (d *DagflowDebug) Mount(group *gin.RouterGroup) {
+	group.GET("/factories", d.listFactories)
+	group.GET("/factories/:name/graph", d.withEntry(d.graph))
+	group.GET("/factories/:name/graph/dot", d.withEntry(d.graphDot))
+	group.GET("/factories/:name/runs", d.withEntry(d.runs))
+	group.GET("/factories/:name/failures", d.withEntry(d.failures))
+	group.GET("/resources", d.resources)
+}
+
+func (d *DagflowDebug) withEntry(handler func(c *gin.Context, entry *factoryEntry)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := c.Param("name")
+		entry, ok := d.getEntry(name)
+		if !ok {
+			c.JSON(http.StatusNotFound, common.CommonResponse[any]{
+				Code: http.StatusNotFound,
+				Msg:  fmt.Sprintf("factory %s not found", name),
+			})
+			return
+		}
+		handler(c, entry)
+	}
+}
+
+func (d *DagflowDebug) listFactories(c *gin.Context) {
+	d.rwLock.RLock()
+	summaries := make([]FactorySummary, 0, len(d.factories))
+	for name, entry := range d.factories {
+		runs := entry.runs.ToSlice()
+		spec, _ := entry.factory.SnapshotGraphSpec()
+		summaries = append(summaries, FactorySummary{
+			Name:           name,
+			Version:        spec.Version,
+			TaskCount:      len(spec.Tasks),
+			RunCount:       len(runs),
+			FailedRunCount: len(Helper.NewestFirst(runs, 0, task_dagflow.RunStatusFailed)),
+		})
+	}
+	d.rwLock.RUnlock()
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].Name < summaries[j].Name
+	})
+	c.JSON(http.StatusOK, common.CommonResponse[[]FactorySummary]{Data: &summaries})
+}
+
+// snapshotSpec returns the graph flows of the factory run on, it responds 404 if the graph is not created yet
+func (d *DagflowDebug) snapshotSpec(c *gin.Context, entry *factoryEntry) (task_dagflow.GraphSpec, bool) {
+	spec, err := entry.factory.SnapshotGraphSpec()
+	if err != nil {
+		c.JSON(http.StatusNotFound, common.CommonResponse[any]{
+			Code: http.StatusNotFound,
+			Msg:  fmt.Sprintf("factory %s: %v", entry.factory.Name(), err),
+		})
+		return task_dagflow.GraphSpec{}, false
+	}
+	return spec, true
+}
+
+func (d *DagflowDebug) graph(c *gin.Context, entry *factoryEntry) {
+	if spec, ok := d.snapshotSpec(c, entry); ok {
+		c.JSON(http.StatusOK, common.CommonResponse[task_dagflow.GraphSpec]{Data: &spec})
+	}
+}
+
+func (d *DagflowDebug) graphDot(c *gin.Context, entry *factoryEntry) {
+	if spec, ok := d.snapshotSpec(c, entry); ok {
+		c.Data(http.StatusOK, "text/vnd.graphviz; charset=utf-8", []byte(spec.DOT()))
+	}
+}
+
+func (d *DagflowDebug) runs(c *gin.Context, entry *factoryEntry) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	status := task_dagflow.RunStatus(c.Query("status"))
+	runs := Helper.NewestFirst(entry.runs.ToSlice(), limit, status)
+	c.JSON(http.StatusOK, common.CommonResponse[[]*task_dagflow.RunReport]{Data: &runs})
+}
+
+func (d *DagflowDebug) failures(c *gin.Context, entry *factoryEntry) {
+	failures := Helper.AggregateFailures(entry.runs.ToSlice())
+	c.JSON(http.StatusOK, common.CommonResponse[[]TaskFailure]{Data: &failures})
+}
+
+func (d *DagflowDebug) resources(c *gin.Context) {
+	stats := task_dagflow.GetResourceStats()
+	c.JSON(http.StatusOK, common.CommonResponse[[]task_dagflow.ResourceStats]{Data: &stats})
+}
@@ -0,0 +1,188 @@
+package dagflow_debug
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Steve-Lee-CST/go-pico-tool/pkg/gin_pkg/common"
+	"github.com/Steve-Lee-CST/go-pico-tool/pkg/task_dagflow"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+type Score int
+
+type scoreCollection struct {
+	userID string
+	score  Score
+}
+
+func (c *scoreCollection) InputTypes() []reflect.Type {
+	return []reflect.Type{reflect.TypeOf(c.userID)}
+}
+
+func (c *scoreCollection) TargetTypes() []reflect.Type {
+	return []reflect.Type{reflect.TypeOf(c.score)}
+}
+
+type scoreTask struct{}
+
+func (t *scoreTask) Name() string { return "ScoreTask" }
+
+func (t *scoreTask) InputTypes() []reflect.Type { return []reflect.Type{reflect.TypeOf("")} }
+
+func (t *scoreTask) OutputType() reflect.Type { return reflect.TypeOf(Score(0)) }
+
+func (t *scoreTask) Timeout() time.Duration { return time.Second }
+
+func (t *scoreTask) Execute(ctx context.Context, collection *scoreCollection) error {
+	if collection.userID == "" {
+		return errors.New("empty user id")
+	}
+	collection.score = Score(len(collection.userID))
+	return nil
+}
+
+func newDebugRouter(t *testing.T) (*gin.Engine, *task_dagflow.Factory[*scoreCollection]) {
+	gin.SetMode(gin.TestMode)
+	factory := task_dagflow.NewFactoryWithConfig[*scoreCollection](task_dagflow.Config{Name: "score"})
+	assert.NoError(t, factory.RegisterTask(func() (task_dagflow.ITask[*scoreCollection], error) {
+		return &scoreTask{}, nil
+	}))
+	assert.NoError(t, factory.CreateGraph())
+
+	debug := NewDagflowDebug(Config{RecentRuns: 2})
+	assert.NoError(t, debug.Register(factory))
+	assert.Error(t, debug.Register(factory), "duplicated factory name should be rejected")
+
+	r := gin.New()
+	debug.Mount(r.Group("/debug/dagflow"))
+	return r, factory
+}
+
+func runScore(t *testing.T, factory *task_dagflow.Factory[*scoreCollection], userID string) error {
+	flow, err := factory.CreateTaskDagflow(&scoreCollection{userID: userID})
+	assert.NoError(t, err)
+	return flow.Execute(context.Background(), time.Second)
+}
+
+func get(r *gin.Engine, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", path, nil)
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestDagflowDebug_Factories(t *testing.T) {
+	r, factory := newDebugRouter(t)
+	assert.NoError(t, runScore(t, factory, "pico"))
+	assert.Error(t, runScore(t, factory, ""))
+
+	w := get(r, "/debug/dagflow/factories")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp common.CommonResponse[[]FactorySummary]
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, []FactorySummary{
+		{Name: "score", Version: 1, TaskCount: 1, RunCount: 2, FailedRunCount: 1},
+	}, *resp.Data)
+}
+
+func TestDagflowDebug_Graph(t *testing.T) {
+	r, _ := newDebugRouter(t)
+
+	w := get(r, "/debug/dagflow/factories/score/graph")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp common.CommonResponse[task_dagflow.GraphSpec]
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "score", resp.Data.Name)
+	assert.Equal(t, uint64(1), resp.Data.Version)
+	assert.Equal(t, "ScoreTask", resp.Data.Tasks[0].Name)
+	assert.Equal(t, []string{"string"}, resp.Data.Tasks[0].InputTypes)
+
+	w = get(r, "/debug/dagflow/factories/score/graph/dot")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, strings.HasPrefix(w.Body.String(), `digraph "score"`))
+	assert.Contains(t, w.Body.String(), `"task:ScoreTask" -> "dagflow_debug.Score"`)
+
+	w = get(r, "/debug/dagflow/factories/unknown/graph")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestDagflowDebug_GraphOfSnapshot(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	factory := task_dagflow.NewFactoryWithConfig[*scoreCollection](task_dagflow.Config{Name: "score"})
+	debug := NewDagflowDebug(GetDefaultConfig())
+	assert.NoError(t, debug.Register(factory))
+	r := gin.New()
+	debug.Mount(r.Group("/debug/dagflow"))
+
+	// registered but no graph created yet: flows can't run
+	assert.NoError(t, factory.RegisterTask(func() (task_dagflow.ITask[*scoreCollection], error) {
+		return &scoreTask{}, nil
+	}))
+	w := get(r, "/debug/dagflow/factories/score/graph")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, w.Body.String(), task_dagflow.ErrGraphNotCreated.Error())
+	assert.Equal(t, http.StatusNotFound, get(r, "/debug/dagflow/factories/score/graph/dot").Code)
+
+	var summaries common.CommonResponse[[]FactorySummary]
+	assert.NoError(t, json.Unmarshal(get(r, "/debug/dagflow/factories").Body.Bytes(), &summaries))
+	assert.Equal(t, []FactorySummary{{Name: "score"}}, *summaries.Data)
+
+	assert.NoError(t, factory.CreateGraph())
+	assert.NoError(t, factory.CreateGraph())
+	w = get(r, "/debug/dagflow/factories/score/graph")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp common.CommonResponse[task_dagflow.GraphSpec]
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, uint64(2), resp.Data.Version)
+	assert.Len(t, resp.Data.Tasks, 1)
+}
+
+func TestDagflowDebug_RunsAndFailures(t *testing.T) {
+	r, factory := newDebugRouter(t)
+	assert.Error(t, runScore(t, factory, ""))
+	assert.NoError(t, runScore(t, factory, "a"))
+	assert.Error(t, runScore(t, factory, "")) // the first run is dropped, only 2 kept
+
+	w := get(r, "/debug/dagflow/factories/score/runs")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var runs common.CommonResponse[[]*task_dagflow.RunReport]
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &runs))
+	assert.Len(t, *runs.Data, 2)
+	assert.Equal(t, task_dagflow.RunStatusFailed, (*runs.Data)[0].Status, "newest first")
+	assert.Equal(t, task_dagflow.RunStatusSuccess, (*runs.Data)[1].Status)
+	assert.Equal(t, task_dagflow.TaskStatusSuccess, (*runs.Data)[1].Tasks[0].Status)
+
+	w = get(r, "/debug/dagflow/factories/score/runs?status=success&limit=5")
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &runs))
+	assert.Len(t, *runs.Data, 1)
+
+	w = get(r, "/debug/dagflow/factories/score/failures")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var failures common.CommonResponse[[]TaskFailure]
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &failures))
+	assert.Len(t, *failures.Data, 1)
+	assert.Equal(t, "ScoreTask", (*failures.Data)[0].TaskName)
+	assert.Equal(t, 1, (*failures.Data)[0].Count)
+	assert.Equal(t, "empty user id", (*failures.Data)[0].LastError)
+}
+
+func TestDagflowDebug_Resources(t *testing.T) {
+	r, _ := newDebugRouter(t)
+	task_dagflow.SetResourceLimit("debug-test-rpc", 3)
+	defer task_dagflow.SetResourceLimit("debug-test-rpc", 0)
+
+	w := get(r, "/debug/dagflow/resources")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp common.CommonResponse[[]task_dagflow.ResourceStats]
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Contains(t, *resp.Data, task_dagflow.ResourceStats{Class: "debug-test-rpc", Limit: 3})
+}
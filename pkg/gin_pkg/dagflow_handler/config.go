@@ -0,0 +1,33 @@
+package dagflow_handler
+
+import (
+	"time"
+
+	"github.com/Steve-Lee-CST/go-pico-tool/pkg/gin_pkg/http_decoder"
+	"github.com/Steve-Lee-CST/go-pico-tool/pkg/gin_pkg/request_id"
+)
+
+type Config struct {
+	// Timeout is the default and the maximum time budget of one flow run
+	Timeout time.Duration
+	// TimeoutHeaderKey is the request header carrying a smaller client budget, e.g. "500ms" or "500"(ms)
+	TimeoutHeaderKey string
+	// HttpDecoderConfig is used to fetch the decoded request set by http_decoder middleware
+	HttpDecoderConfig http_decoder.Config
+	// RequestIDConfig is used to read the request id passed to tasks, see task_dagflow.RequestIDFromContext
+	RequestIDConfig request_id.Config
+	// ErrorMapper maps flow errors to http status, response code and message
+	ErrorMapper ErrorMapper
+}
+
+var defaultConfig = Config{
+	Timeout:           3 * time.Second,
+	TimeoutHeaderKey:  "X-Request-Timeout",
+	HttpDecoderConfig: http_decoder.DefaultConfig(),
+	RequestIDConfig:   request_id.GetDefaultConfig(),
+	ErrorMapper:       DefaultErrorMapper,
+}
+
+func GetDefaultConfig() Config {
+	return defaultConfig
+}
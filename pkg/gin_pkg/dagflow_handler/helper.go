@@ -0,0 +1,96 @@
+package dagflow_handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Steve-Lee-CST/go-pico-tool/pkg/task_dagflow"
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	ErrBuildCollection = errors.New("failed to build collection from request")
+	ErrCreateFlow      = errors.New("failed to create task dagflow")
+	ErrFlowTimeout     = errors.New("task dagflow deadline exceeded")
+	ErrFlowCanceled    = errors.New("task dagflow canceled")
+	ErrBuildResult     = errors.New("failed to build result from collection")
+)
+
+// StatusClientClosedRequest is used when the client gives up before the flow finishes
+const StatusClientClosedRequest = 499
+
+// ErrorMapper maps an error returned by the handler pipeline to http status, response code and message
+type ErrorMapper func(err error) (httpStatus int, code int, msg string)
+
+func DefaultErrorMapper(err error) (int, int, string) {
+	switch {
+	case errors.Is(err, ErrBuildCollection):
+		return http.StatusBadRequest, http.StatusBadRequest, err.Error()
+	case errors.Is(err, ErrFlowTimeout), errors.Is(err, task_dagflow.ErrTaskTimeout):
+		return http.StatusGatewayTimeout, http.StatusGatewayTimeout, err.Error()
+	case errors.Is(err, ErrFlowCanceled):
+		return StatusClientClosedRequest, StatusClientClosedRequest, err.Error()
+	default:
+		return http.StatusInternalServerError, http.StatusInternalServerError, err.Error()
+	}
+}
+
+type helper struct{}
+
+var Helper = helper{}
+
+// GetTimeout returns the time budget of the flow run:
+// the smallest of config.Timeout, the header value and the remaining request context deadline.
+func (h helper) GetTimeout(c *gin.Context, config Config) time.Duration {
+	timeout := config.Timeout
+	if config.TimeoutHeaderKey != "" {
+		if headerTimeout, ok := h.parseTimeout(c.GetHeader(config.TimeoutHeaderKey)); ok &&
+			(timeout <= 0 || headerTimeout < timeout) {
+			timeout = headerTimeout
+		}
+	}
+	if deadline, ok := c.Request.Context().Deadline(); ok {
+		if remain := time.Until(deadline); timeout <= 0 || remain < timeout {
+			timeout = remain
+		}
+	}
+	return timeout
+}
+
+// parseTimeout accepts a go duration string ("500ms", "2s") or a plain integer in milliseconds
+func (h helper) parseTimeout(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if ms, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if ms <= 0 {
+			return 0, false
+		}
+		return time.Duration(ms) * time.Millisecond, true
+	}
+	if d, err := time.ParseDuration(value); err == nil && d > 0 {
+		return d, true
+	}
+	return 0, false
+}
+
+// WrapFlowError classifies a flow error by the context and the deadline of the run
+func (h helper) WrapFlowError(ctx context.Context, deadline time.Time, err error) error {
+	if err == nil {
+		return nil
+	}
+	switch {
+	case errors.Is(err, task_dagflow.ErrFlowTimeout),
+		errors.Is(err, context.DeadlineExceeded) && ctx.Err() != nil,
+		!time.Now().Before(deadline):
+		return fmt.Errorf("%w: %w", ErrFlowTimeout, err)
+	case errors.Is(err, context.Canceled) || errors.Is(ctx.Err(), context.Canceled):
+		return fmt.Errorf("%w: %w", ErrFlowCanceled, err)
+	default:
+		return err
+	}
+}
@@ -0,0 +1,96 @@
+package dagflow_handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Steve-Lee-CST/go-pico-tool/pkg/gin_pkg/common"
+	"github.com/Steve-Lee-CST/go-pico-tool/pkg/gin_pkg/http_decoder"
+	"github.com/Steve-Lee-CST/go-pico-tool/pkg/gin_pkg/request_id"
+	"github.com/Steve-Lee-CST/go-pico-tool/pkg/task_dagflow"
+	"github.com/gin-gonic/gin"
+)
+
+// CollectionBuilder builds the collection of one run from the request.
+// req is the request decoded by http_decoder middleware, nil if the middleware is not used.
+type CollectionBuilder[CT task_dagflow.ICollection] func(c *gin.Context, req *http_decoder.HttpRequest) (CT, error)
+
+// ResultBuilder picks the target values out of a finished collection
+type ResultBuilder[CT task_dagflow.ICollection, T any] func(collection CT) (*T, error)
+
+type DagflowHandler[CT task_dagflow.ICollection, T any] struct {
+	config          Config
+	factory         *task_dagflow.Factory[CT]
+	buildCollection CollectionBuilder[CT]
+	buildResult     ResultBuilder[CT, T]
+}
+
+func NewDagflowHandler[CT task_dagflow.ICollection, T any](
+	config Config, factory *task_dagflow.Factory[CT],
+	buildCollection CollectionBuilder[CT], buildResult ResultBuilder[CT, T],
+) *DagflowHandler[CT, T] {
+	if config.Timeout <= 0 {
+		config.Timeout = GetDefaultConfig().Timeout
+	}
+	if config.ErrorMapper == nil {
+		config.ErrorMapper = DefaultErrorMapper
+	}
+	return &DagflowHandler[CT, T]{
+		config:          config,
+		factory:         factory,
+		buildCollection: buildCollection,
+		buildResult:     buildResult,
+	}
+}
+
+// Run builds the collection from the request, executes the flow within the request deadline
+// and returns the result built from the collection.
+func (h *DagflowHandler[CT, T]) Run(c *gin.Context) (*T, error) {
+	req := http_decoder.Helper.GetHttpRequest(c, h.config.HttpDecoderConfig)
+	collection, err := h.buildCollection(c, req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrBuildCollection, err)
+	}
+	flow, err := h.factory.CreateTaskDagflow(collection)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCreateFlow, err)
+	}
+
+	timeout := Helper.GetTimeout(c, h.config)
+	deadline := time.Now().Add(timeout)
+	ctx, cancel := context.WithDeadline(c.Request.Context(), deadline)
+	defer cancel()
+	if requestID, ok := request_id.Helper.GetRequestIDFromRequest(c, h.config.RequestIDConfig); ok {
+		ctx = task_dagflow.WithRequestID(ctx, requestID)
+	}
+	if err := flow.Execute(ctx, timeout); err != nil {
+		return nil, Helper.WrapFlowError(ctx, deadline, err)
+	}
+
+	result, err := h.buildResult(collection)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrBuildResult, err)
+	}
+	return result, nil
+}
+
+func (h *DagflowHandler[CT, T]) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		result, err := h.Run(c)
+		if err != nil {
+			status, code, msg := h.config.ErrorMapper(err)
+			c.JSON(status, common.CommonResponse[T]{
+				Code: code,
+				Msg:  msg,
+			})
+			return
+		}
+		c.JSON(http.StatusOK, common.CommonResponse[T]{
+			Code: 0,
+			Msg:  "",
+			Data: result,
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package dagflow_handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Steve-Lee-CST/go-pico-tool/pkg/gin_pkg/common"
+	"github.com/Steve-Lee-CST/go-pico-tool/pkg/gin_pkg/http_decoder"
+	"github.com/Steve-Lee-CST/go-pico-tool/pkg/task_dagflow"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+type Greeting struct {
+	Text string `json:"text"`
+}
+
+type greetingCollection struct {
+	name     string
+	greeting Greeting
+}
+
+func (c *greetingCollection) InputTypes() []reflect.Type {
+	return []reflect.Type{reflect.TypeOf(c.name)}
+}
+
+func (c *greetingCollection) TargetTypes() []reflect.Type {
+	return []reflect.Type{reflect.TypeOf(c.greeting)}
+}
+
+type greetingTask struct {
+	delay     time.Duration
+	err       error
+	requestID string
+}
+
+func (t *greetingTask) Name() string { return "GreetingTask" }
+
+func (t *greetingTask) InputTypes() []reflect.Type { return []reflect.Type{reflect.TypeOf("")} }
+
+func (t *greetingTask) OutputType() reflect.Type { return reflect.TypeOf(Greeting{}) }
+
+func (t *greetingTask) Timeout() time.Duration { return time.Second }
+
+func (t *greetingTask) Execute(ctx context.Context, collection *greetingCollection) error {
+	t.requestID = task_dagflow.RequestIDFromContext(ctx)
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(t.delay):
+	}
+	if t.err != nil {
+		return t.err
+	}
+	collection.greeting = Greeting{Text: "hello " + collection.name}
+	return nil
+}
+
+func newGreetingRouter(t *testing.T, task *greetingTask) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	factory := task_dagflow.NewFactory[*greetingCollection]()
+	err := factory.RegisterTask(func() (task_dagflow.ITask[*greetingCollection], error) {
+		return task, nil
+	})
+	assert.NoError(t, err)
+	factory.CreateGraph()
+
+	handler := NewDagflowHandler(GetDefaultConfig(), factory,
+		func(c *gin.Context, req *http_decoder.HttpRequest) (*greetingCollection, error) {
+			if req == nil {
+				return nil, errors.New("request is not decoded")
+			}
+			name := req.QueryParams.Get("name")
+			if name == "" {
+				return nil, errors.New("name is required")
+			}
+			return &greetingCollection{name: name}, nil
+		},
+		func(collection *greetingCollection) (*Greeting, error) {
+			return &collection.greeting, nil
+		},
+	)
+	r := gin.New()
+	r.Use(http_decoder.NewHttpDecoder(http_decoder.DefaultConfig()).Middleware())
+	r.GET("/greeting", handler.Handler())
+	return r
+}
+
+func TestDagflowHandler_Success(t *testing.T) {
+	r := newGreetingRouter(t, &greetingTask{})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/greeting?name=pico", nil)
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp common.CommonResponse[Greeting]
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, 0, resp.Code)
+	assert.NotNil(t, resp.Data)
+	assert.Equal(t, "hello pico", resp.Data.Text)
+}
+
+func TestDagflowHandler_RequestID(t *testing.T) {
+	task := &greetingTask{}
+	r := newGreetingRouter(t, task)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/greeting?name=pico", nil)
+	req.Header.Set("X-Request-ID", "req-1")
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "req-1", task.requestID)
+}
+
+func TestDagflowHandler_BadRequest(t *testing.T) {
+	r := newGreetingRouter(t, &greetingTask{})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/greeting", nil)
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var resp common.CommonResponse[Greeting]
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Nil(t, resp.Data)
+}
+
+func TestDagflowHandler_HeaderTimeout(t *testing.T) {
+	r := newGreetingRouter(t, &greetingTask{delay: 500 * time.Millisecond})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/greeting?name=pico", nil)
+	req.Header.Set("X-Request-Timeout", "50ms")
+	start := time.Now()
+	r.ServeHTTP(w, req)
+
+	assert.Less(t, time.Since(start), 400*time.Millisecond)
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+}
+
+func TestDagflowHandler_TaskError(t *testing.T) {
+	r := newGreetingRouter(t, &greetingTask{err: errors.New("greeting service down")})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/greeting?name=pico", nil)
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Contains(t, w.Body.String(), "greeting service down")
+}
+
+func TestHelper_GetTimeout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := GetDefaultConfig()
+	for header, expected := range map[string]time.Duration{
+		"":       cfg.Timeout,
+		"200":    200 * time.Millisecond,
+		"1500ms": 1500 * time.Millisecond,
+		"10s":    cfg.Timeout, // never exceed config timeout
+		"abc":    cfg.Timeout,
+		"-5":     cfg.Timeout,
+	} {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request, _ = http.NewRequest("GET", "/", nil)
+		if header != "" {
+			c.Request.Header.Set(cfg.TimeoutHeaderKey, header)
+		}
+		assert.Equal(t, expected, Helper.GetTimeout(c, cfg), "header: "+strconv.Quote(header))
+	}
+}
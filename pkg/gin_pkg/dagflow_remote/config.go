@@ -0,0 +1,28 @@
+package dagflow_remote
+
+import (
+	"net/http"
+	"time"
+)
+
+type Config struct {
+	// TaskParamKey is the gin route param holding the task name, e.g. "/tasks/:task"
+	TaskParamKey string
+	// TimeoutHeaderKey carries the time left for the task from the client to the server, in milliseconds
+	TimeoutHeaderKey string
+	// Timeout is the server's default and maximum time budget of one task call
+	Timeout time.Duration
+	// HttpClient is used by Client, http.DefaultClient if nil
+	HttpClient *http.Client
+}
+
+var defaultConfig = Config{
+	TaskParamKey:     "task",
+	TimeoutHeaderKey: "X-Request-Timeout",
+	Timeout:          10 * time.Second,
+	HttpClient:       nil,
+}
+
+func GetDefaultConfig() Config {
+	return defaultConfig
+}
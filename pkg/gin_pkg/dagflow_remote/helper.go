@@ -0,0 +1,91 @@
+package dagflow_remote
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrTaskNotFound   = errors.New("remote task not found")
+	ErrBadRequest     = errors.New("bad remote task request")
+	ErrRemoteFailed   = errors.New("remote task failed")
+	ErrRemoteProtocol = errors.New("bad remote task response")
+)
+
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// TaskInput is one argument of the task function, Type is checked by the server
+// so client and server can't silently disagree on the signature
+type TaskInput struct {
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value"`
+}
+
+// TaskRequest is the body posted to the server, inputs follow the function's parameters after ctx
+type TaskRequest struct {
+	Inputs []TaskInput `json:"inputs"`
+}
+
+type helper struct{}
+
+var Helper = helper{}
+
+// CheckFunc checks fn has the task function signature: func(ctx context.Context, in1 T1, ...) (Out, error)
+func (h helper) CheckFunc(fn any) (reflect.Type, error) {
+	fnType := reflect.TypeOf(fn)
+	if fnType == nil || fnType.Kind() != reflect.Func {
+		return nil, fmt.Errorf("expected a function, got %T", fn)
+	}
+	if fnType.IsVariadic() || fnType.NumIn() == 0 || fnType.In(0) != contextType {
+		return nil, fmt.Errorf("function %s must take context.Context as first parameter", fnType)
+	}
+	if fnType.NumOut() != 2 || fnType.Out(1) != errorType {
+		return nil, fmt.Errorf("function %s must return (output, error)", fnType)
+	}
+	return fnType, nil
+}
+
+// FormatTimeout returns the header value for the time left before ctx's deadline, false if there's no deadline
+func (h helper) FormatTimeout(ctx context.Context) (string, bool) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return "", false
+	}
+	ms := time.Until(deadline).Milliseconds()
+	if ms < 1 {
+		ms = 1
+	}
+	return strconv.FormatInt(ms, 10), true
+}
+
+// ParseTimeout parses a header value written by FormatTimeout
+func (h helper) ParseTimeout(value string) (time.Duration, bool) {
+	ms, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || ms <= 0 {
+		return 0, false
+	}
+	return time.Duration(ms) * time.Millisecond, true
+}
+
+// ErrorStatus maps an error of Server.Call to the http status of the response
+func (h helper) ErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrTaskNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrBadRequest):
+		return http.StatusBadRequest
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,224 @@
+package dagflow_remote
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Steve-Lee-CST/go-pico-tool/pkg/gin_pkg/common"
+	"github.com/Steve-Lee-CST/go-pico-tool/pkg/task_dagflow"
+	"github.com/gin-gonic/gin"
+)
+
+// Client calls tasks served by a Server at endpoint, e.g. "http://worker:8080/tasks"
+type Client struct {
+	config   Config
+	endpoint string
+}
+
+func NewClient(config Config, endpoint string) *Client {
+	if config.HttpClient == nil {
+		config.HttpClient = http.DefaultClient
+	}
+	if config.TimeoutHeaderKey == "" {
+		config.TimeoutHeaderKey = GetDefaultConfig().TimeoutHeaderKey
+	}
+	return &Client{config: config, endpoint: strings.TrimSuffix(endpoint, "/")}
+}
+
+// Call posts inputs to the remote task name and decodes its output into outputType,
+// name is escaped as one path segment
+func (cl *Client) Call(
+	ctx context.Context, name string, inputs []reflect.Value, outputType reflect.Type,
+) (reflect.Value, error) {
+	body := TaskRequest{Inputs: make([]TaskInput, 0, len(inputs))}
+	for _, input := range inputs {
+		value, err := json.Marshal(input.Interface())
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("failed to encode input %s: %w", input.Type(), err)
+		}
+		body.Inputs = append(body.Inputs, TaskInput{Type: input.Type().String(), Value: value})
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cl.endpoint+"/"+url.PathEscape(name), bytes.NewReader(data))
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if timeout, ok := Helper.FormatTimeout(ctx); ok {
+		req.Header.Set(cl.config.TimeoutHeaderKey, timeout)
+	}
+	resp, err := cl.config.HttpClient.Do(req)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	defer resp.Body.Close()
+	respData, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+
+	result := common.CommonResponse[json.RawMessage]{}
+	if err := json.Unmarshal(respData, &result); err != nil {
+		return reflect.Value{}, fmt.Errorf("%w: status %d: %w", ErrRemoteProtocol, resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK || result.Code != 0 {
+		return reflect.Value{}, fmt.Errorf("%w: %s: status %d: %s", ErrRemoteFailed, name, resp.StatusCode, result.Msg)
+	}
+	output := reflect.New(outputType)
+	if result.Data != nil {
+		if err := json.Unmarshal(*result.Data, output.Interface()); err != nil {
+			return reflect.Value{}, fmt.Errorf("%w: failed to decode output %s: %w", ErrRemoteProtocol, outputType, err)
+		}
+	}
+	return output.Elem(), nil
+}
+
+// NewRemoteTaskCreateFunc creates a task calling the remote task name. fn is the task function served
+// by the remote Server, only its signature is used here: inputs and output are bound to the collection
+// like task_dagflow.NewFuncTask, so one function keeps local and remote flow definitions in sync.
+func NewRemoteTaskCreateFunc[CT task_dagflow.ICollection](
+	client *Client, name string, timeout time.Duration, fn any,
+) task_dagflow.TaskCreateFunc[CT] {
+	return func() (task_dagflow.ITask[CT], error) {
+		fnType, err := Helper.CheckFunc(fn)
+		if err != nil {
+			return nil, fmt.Errorf("remote task %s: %w", name, err)
+		}
+		outputType := fnType.Out(0)
+		remote := reflect.MakeFunc(fnType, func(args []reflect.Value) []reflect.Value {
+			ctx, _ := args[0].Interface().(context.Context)
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			output, err := client.Call(ctx, name, args[1:], outputType)
+			if err == nil {
+				// drop a response arriving after the task timed out, a fallback may own the output
+				err = ctx.Err()
+			}
+			if err != nil {
+				return []reflect.Value{reflect.Zero(outputType), reflect.ValueOf(&err).Elem()}
+			}
+			return []reflect.Value{output, reflect.Zero(errorType)}
+		})
+		return task_dagflow.NewFuncTask[CT](name, timeout, remote.Interface())
+	}
+}
+
+// Server serves registered task functions to remote clients
+type Server struct {
+	config Config
+	lock   sync.RWMutex
+	tasks  map[string]reflect.Value
+}
+
+func NewServer(config Config) *Server {
+	if config.TaskParamKey == "" {
+		config.TaskParamKey = GetDefaultConfig().TaskParamKey
+	}
+	if config.TimeoutHeaderKey == "" {
+		config.TimeoutHeaderKey = GetDefaultConfig().TimeoutHeaderKey
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = GetDefaultConfig().Timeout
+	}
+	return &Server{config: config, tasks: make(map[string]reflect.Value)}
+}
+
+// Register serves fn as the remote task name, fn has the signature of task_dagflow.NewFuncTask
+func (s *Server) Register(name string, fn any) error {
+	if _, err := Helper.CheckFunc(fn); err != nil {
+		return fmt.Errorf("remote task %s: %w", name, err)
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, exists := s.tasks[name]; exists {
+		return fmt.Errorf("remote task %s registered twice", name)
+	}
+	s.tasks[name] = reflect.ValueOf(fn)
+	return nil
+}
+
+// Call decodes the request, runs the task with the time left announced by the client
+// and returns its output
+func (s *Server) Call(ctx context.Context, name string, timeout time.Duration, req *TaskRequest) (any, error) {
+	s.lock.RLock()
+	fn, exists := s.tasks[name]
+	s.lock.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrTaskNotFound, name)
+	}
+
+	fnType := fn.Type()
+	if len(req.Inputs) != fnType.NumIn()-1 {
+		return nil, fmt.Errorf("%w: %s expects %d inputs, got %d", ErrBadRequest, name, fnType.NumIn()-1, len(req.Inputs))
+	}
+	if timeout <= 0 || timeout > s.config.Timeout {
+		timeout = s.config.Timeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	args := make([]reflect.Value, 0, fnType.NumIn())
+	args = append(args, reflect.ValueOf(&ctx).Elem())
+	for i, input := range req.Inputs {
+		inputType := fnType.In(i + 1)
+		if input.Type != inputType.String() {
+			return nil, fmt.Errorf("%w: %s input %d is %s, got %s", ErrBadRequest, name, i, inputType, input.Type)
+		}
+		value := reflect.New(inputType)
+		if err := json.Unmarshal(input.Value, value.Interface()); err != nil {
+			return nil, fmt.Errorf("%w: failed to decode input %s: %w", ErrBadRequest, inputType, err)
+		}
+		args = append(args, value.Elem())
+	}
+
+	return s.call(name, fn, args)
+}
+
+// call runs the task function, a panic is returned as ErrRemoteFailed instead of reaching the gin engine
+func (s *Server) call(name string, fn reflect.Value, args []reflect.Value) (output any, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			output, err = nil, fmt.Errorf("%w: %s panicked: %v", ErrRemoteFailed, name, r)
+		}
+	}()
+	results := fn.Call(args)
+	if err, _ := results[1].Interface().(error); err != nil {
+		return nil, err
+	}
+	return results[0].Interface(), nil
+}
+
+func (s *Server) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		req := &TaskRequest{}
+		if err := c.ShouldBindJSON(req); err != nil {
+			c.JSON(http.StatusBadRequest, common.CommonResponse[any]{
+				Code: http.StatusBadRequest,
+				Msg:  fmt.Sprintf("%s: %s", ErrBadRequest, err),
+			})
+			return
+		}
+		timeout, _ := Helper.ParseTimeout(c.GetHeader(s.config.TimeoutHeaderKey))
+		output, err := s.Call(c.Request.Context(), c.Param(s.config.TaskParamKey), timeout, req)
+		if err != nil {
+			status := Helper.ErrorStatus(err)
+			c.JSON(status, common.CommonResponse[any]{Code: status, Msg: err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, common.CommonResponse[any]{Code: 0, Msg: "", Data: &output})
+	}
+}
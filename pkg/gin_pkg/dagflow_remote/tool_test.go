@@ -0,0 +1,187 @@
+package dagflow_remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Steve-Lee-CST/go-pico-tool/pkg/task_dagflow"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+type User struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type Greeting struct {
+	Text string `json:"text"`
+}
+
+type greetingCollection struct {
+	users    []User
+	title    string
+	greeting Greeting
+}
+
+func (c *greetingCollection) InputTypes() []reflect.Type {
+	return []reflect.Type{reflect.TypeOf(c.title)}
+}
+
+func (c *greetingCollection) TargetTypes() []reflect.Type {
+	return []reflect.Type{reflect.TypeOf(c.greeting)}
+}
+
+func (c *greetingCollection) GetUsers() []User              { return c.users }
+func (c *greetingCollection) SetUsers(users []User)         { c.users = users }
+func (c *greetingCollection) GetTitle() string              { return c.title }
+func (c *greetingCollection) GetGreeting() Greeting         { return c.greeting }
+func (c *greetingCollection) SetGreeting(greeting Greeting) { c.greeting = greeting }
+
+func fetchUsers(ctx context.Context) ([]User, error) {
+	return []User{{ID: 1, Name: "Ada"}, {ID: 2, Name: "Linus"}}, nil
+}
+
+// greet is the heavy task served by the worker
+func greet(ctx context.Context, users []User, title string) (Greeting, error) {
+	names := make([]string, 0, len(users))
+	for _, user := range users {
+		names = append(names, title+" "+user.Name)
+	}
+	return Greeting{Text: "hello " + strings.Join(names, ", ")}, nil
+}
+
+func newWorker(t *testing.T, register func(server *Server)) *httptest.Server {
+	gin.SetMode(gin.TestMode)
+	server := NewServer(GetDefaultConfig())
+	register(server)
+	router := gin.New()
+	// task names may contain an escaped "/"
+	router.UseRawPath = true
+	router.POST("/tasks/:task", server.Handler())
+	worker := httptest.NewServer(router)
+	t.Cleanup(worker.Close)
+	return worker
+}
+
+func runFlow(client *Client, remoteName string, timeout time.Duration, fn any) (*greetingCollection, error) {
+	factory := task_dagflow.NewFactory[*greetingCollection]()
+	if err := factory.RegisterTask(task_dagflow.NewFuncTaskCreateFunc[*greetingCollection](
+		"UsersTask", time.Second, fetchUsers)); err != nil {
+		return nil, err
+	}
+	if err := factory.RegisterTask(NewRemoteTaskCreateFunc[*greetingCollection](
+		client, remoteName, timeout, fn)); err != nil {
+		return nil, err
+	}
+	if err := factory.CreateGraph(); err != nil {
+		return nil, err
+	}
+	collection := &greetingCollection{title: "Dr."}
+	flow, err := factory.CreateTaskDagflow(collection)
+	if err != nil {
+		return nil, err
+	}
+	return collection, flow.Execute(context.Background(), 2*time.Second)
+}
+
+func TestRemoteTask_Success(t *testing.T) {
+	worker := newWorker(t, func(server *Server) {
+		assert.NoError(t, server.Register("GreetTask", greet))
+	})
+	client := NewClient(GetDefaultConfig(), worker.URL+"/tasks/")
+
+	collection, err := runFlow(client, "GreetTask", time.Second, greet)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello Dr. Ada, Dr. Linus", collection.greeting.Text)
+}
+
+func TestRemoteTask_Errors(t *testing.T) {
+	worker := newWorker(t, func(server *Server) {
+		assert.NoError(t, server.Register("GreetTask", greet))
+		assert.NoError(t, server.Register("FailingTask", func(ctx context.Context, users []User, title string) (Greeting, error) {
+			return Greeting{}, errors.New("model unavailable")
+		}))
+		assert.Error(t, server.Register("GreetTask", greet))
+		assert.Error(t, server.Register("BadTask", func(users []User) Greeting { return Greeting{} }))
+	})
+	client := NewClient(GetDefaultConfig(), worker.URL+"/tasks")
+
+	_, err := runFlow(client, "FailingTask", time.Second, greet)
+	assert.ErrorIs(t, err, ErrRemoteFailed)
+	assert.ErrorContains(t, err, "model unavailable")
+
+	_, err = runFlow(client, "MissingTask", time.Second, greet)
+	assert.ErrorIs(t, err, ErrRemoteFailed)
+	assert.ErrorContains(t, err, "status 404")
+
+	// client and server disagree on the signature
+	_, err = runFlow(client, "GreetTask", time.Second, func(ctx context.Context, title string, users []User) (Greeting, error) {
+		return Greeting{}, nil
+	})
+	assert.ErrorContains(t, err, "status 400")
+
+	// not a task function
+	_, err = runFlow(client, "GreetTask", time.Second, "greet")
+	assert.Error(t, err)
+}
+
+func TestRemoteTask_Timeout(t *testing.T) {
+	budgets := make(chan time.Duration, 1)
+	worker := newWorker(t, func(server *Server) {
+		assert.NoError(t, server.Register("SlowTask", func(ctx context.Context, users []User, title string) (Greeting, error) {
+			deadline, _ := ctx.Deadline()
+			budgets <- time.Until(deadline)
+			<-ctx.Done()
+			return Greeting{}, ctx.Err()
+		}))
+	})
+	client := NewClient(GetDefaultConfig(), worker.URL+"/tasks")
+
+	_, err := runFlow(client, "SlowTask", 200*time.Millisecond, greet)
+	assert.Error(t, err)
+	budget := <-budgets
+	assert.True(t, budget > 0 && budget <= 200*time.Millisecond, fmt.Sprintf("server budget %v", budget))
+}
+
+func TestServer_BadRequest(t *testing.T) {
+	worker := newWorker(t, func(server *Server) {
+		assert.NoError(t, server.Register("GreetTask", greet))
+	})
+	for _, body := range []string{
+		`not json`,
+		`{"inputs":[]}`,
+		`{"inputs":[{"type":"[]dagflow_remote.User","value":"x"},{"type":"string","value":"Dr."}]}`,
+	} {
+		resp, err := http.Post(worker.URL+"/tasks/GreetTask", "application/json", strings.NewReader(body))
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, body)
+		_ = resp.Body.Close()
+	}
+}
+
+func TestRemoteTask_EscapedNameAndPanic(t *testing.T) {
+	worker := newWorker(t, func(server *Server) {
+		assert.NoError(t, server.Register("greet/v2 task?", greet))
+		assert.NoError(t, server.Register("PanicTask", func(ctx context.Context, users []User, title string) (Greeting, error) {
+			panic("model crashed")
+		}))
+	})
+	client := NewClient(GetDefaultConfig(), worker.URL+"/tasks")
+
+	collection, err := runFlow(client, "greet/v2 task?", time.Second, greet)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello Dr. Ada, Dr. Linus", collection.greeting.Text)
+
+	_, err = runFlow(client, "PanicTask", time.Second, greet)
+	assert.ErrorIs(t, err, ErrRemoteFailed)
+	assert.ErrorContains(t, err, "status 500")
+	assert.ErrorContains(t, err, "PanicTask panicked: model crashed")
+}
@@ -0,0 +1,233 @@
+package task_dagflow
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// BatchConfig configures ExecuteBatch and StreamBatch
+type BatchConfig struct {
+	// Workers is the number of flows executing at the same time, runtime.GOMAXPROCS(0) if <= 0
+	Workers int
+	// Timeout is the timeout of every flow
+	Timeout time.Duration
+	// Ordered delivers results in input order, a slow item holds back the results after it.
+	// ExecuteBatch always returns results in input order.
+	Ordered bool
+	// StopOnError stops taking items after the first failed one, items already started still finish
+	StopOnError bool
+}
+
+// BatchResult is the outcome of one item of a batch
+type BatchResult[CT ICollection] struct {
+	// Index is the position of the item in the input
+	Index      int
+	Collection CT
+	// Report is nil if the flow could not be created
+	Report *RunReport
+	Err    error
+}
+
+// BatchStats aggregates the results of a batch
+type BatchStats struct {
+	Items     int `json:"items"`
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"`
+	// TimeCost is the wall time of the batch, ItemsPerSecond is Items over it
+	TimeCost       time.Duration `json:"time_cost"`
+	ItemsPerSecond float64       `json:"items_per_second"`
+	// AvgTimeCost and MaxTimeCost are time costs of the flows, items whose flow could not be created are left out
+	AvgTimeCost time.Duration `json:"avg_time_cost"`
+	MaxTimeCost time.Duration `json:"max_time_cost"`
+	// FailedTasks counts failed items by the name of the failed task, "" for other errors
+	// such as flow timeouts or flows which could not be created
+	FailedTasks map[string]int `json:"failed_tasks,omitempty"`
+}
+
+// Batch is a running StreamBatch
+type Batch[CT ICollection] struct {
+	results   chan BatchResult[CT]
+	lock      sync.Mutex
+	startTime time.Time
+	finished  bool
+	stats     BatchStats
+	// executed and totalCost are the number and total time cost of executed flows
+	executed  int
+	totalCost time.Duration
+}
+
+// ExecuteBatch runs a flow of the snapshot for every collection and returns the results in input order.
+// Items skipped by StopOnError or a canceled ctx have no result.
+func (s *Snapshot[CT]) ExecuteBatch(ctx context.Context, collections []CT, config BatchConfig) ([]BatchResult[CT], BatchStats) {
+	// feedCtx releases the feeding goroutine when the batch stops early
+	feedCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	input := make(chan CT)
+	go func() {
+		defer close(input)
+		for _, collection := range collections {
+			select {
+			case input <- collection:
+			case <-feedCtx.Done():
+				return
+			}
+		}
+	}()
+	config.Ordered = true
+	batch := s.StreamBatch(ctx, input, config)
+	results := make([]BatchResult[CT], 0, len(collections))
+	for result := range batch.Results() {
+		results = append(results, result)
+	}
+	return results, batch.Stats()
+}
+
+// StreamBatch runs a flow of the snapshot for every collection received until collections is closed or ctx is done,
+// on a pool of config.Workers goroutines. All items run with this snapshot even if the factory is reloaded meanwhile.
+// Results must be drained: workers block while the results channel is full.
+func (s *Snapshot[CT]) StreamBatch(ctx context.Context, collections <-chan CT, config BatchConfig) *Batch[CT] {
+	workers := config.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	batch := &Batch[CT]{
+		results:   make(chan BatchResult[CT], workers),
+		startTime: time.Now(),
+		stats:     BatchStats{FailedTasks: make(map[string]int)},
+	}
+
+	// stopCtx only stops taking items, started items run with ctx
+	stopCtx, stop := context.WithCancel(ctx)
+	items := make(chan BatchResult[CT])
+	go func() {
+		defer close(items)
+		for index := 0; ; index++ {
+			var collection CT
+			var ok bool
+			select {
+			case <-stopCtx.Done():
+				return
+			case collection, ok = <-collections:
+				if !ok {
+					return
+				}
+			}
+			select {
+			case <-stopCtx.Done():
+				return
+			case items <- BatchResult[CT]{Index: index, Collection: collection}:
+			}
+		}
+	}()
+
+	done := make(chan BatchResult[CT], workers)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range items {
+				done <- s.executeBatchItem(ctx, item, config.Timeout)
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	go func() {
+		defer close(batch.results)
+		defer stop()
+		// pending holds results of Ordered batches waiting for the results before them
+		pending := make(map[int]BatchResult[CT])
+		next := 0
+		for result := range done {
+			batch.record(result)
+			if result.Err != nil && config.StopOnError {
+				stop()
+			}
+			if !config.Ordered {
+				batch.results <- result
+				continue
+			}
+			pending[result.Index] = result
+			for result, ok := pending[next]; ok; result, ok = pending[next] {
+				delete(pending, next)
+				batch.results <- result
+				next++
+			}
+		}
+		batch.finish()
+	}()
+	return batch
+}
+
+func (s *Snapshot[CT]) executeBatchItem(ctx context.Context, item BatchResult[CT], timeout time.Duration) BatchResult[CT] {
+	flow, err := s.CreateTaskDagflow(item.Collection)
+	if err != nil {
+		item.Err = err
+		return item
+	}
+	item.Err = flow.Execute(ctx, timeout)
+	item.Report = flow.Report()
+	return item
+}
+
+// Results delivers a result per item, it is closed when the batch is over
+func (b *Batch[CT]) Results() <-chan BatchResult[CT] {
+	return b.results
+}
+
+// Stats returns the statistics of the items finished so far, final once Results is closed
+func (b *Batch[CT]) Stats() BatchStats {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	stats := b.stats
+	if !b.finished {
+		stats.TimeCost = time.Since(b.startTime)
+	}
+	if stats.TimeCost > 0 {
+		stats.ItemsPerSecond = float64(stats.Items) / stats.TimeCost.Seconds()
+	}
+	if b.executed > 0 {
+		stats.AvgTimeCost = b.totalCost / time.Duration(b.executed)
+	}
+	stats.FailedTasks = make(map[string]int, len(b.stats.FailedTasks))
+	for task, count := range b.stats.FailedTasks {
+		stats.FailedTasks[task] = count
+	}
+	return stats
+}
+
+func (b *Batch[CT]) record(result BatchResult[CT]) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.stats.Items++
+	if result.Report != nil {
+		b.executed++
+		b.totalCost += result.Report.TimeCost
+		b.stats.MaxTimeCost = max(b.stats.MaxTimeCost, result.Report.TimeCost)
+	}
+	if result.Err == nil {
+		b.stats.Succeeded++
+		return
+	}
+	b.stats.Failed++
+	var taskErr *TaskError
+	if errors.As(result.Err, &taskErr) {
+		b.stats.FailedTasks[taskErr.TaskName]++
+	} else {
+		b.stats.FailedTasks[""]++
+	}
+}
+
+func (b *Batch[CT]) finish() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.finished = true
+	b.stats.TimeCost = time.Since(b.startTime)
+}
@@ -0,0 +1,120 @@
+package task_dagflow
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// benchCollection only declares types, bench tasks don't touch it
+type benchCollection struct {
+	targets []reflect.Type
+}
+
+func (c *benchCollection) InputTypes() []reflect.Type {
+	return []reflect.Type{nil}
+}
+
+func (c *benchCollection) TargetTypes() []reflect.Type {
+	return c.targets
+}
+
+type benchTask struct {
+	name   string
+	inputs []reflect.Type
+	output reflect.Type
+}
+
+func (t *benchTask) Name() string                                                   { return t.name }
+func (t *benchTask) InputTypes() []reflect.Type                                     { return t.inputs }
+func (t *benchTask) OutputType() reflect.Type                                       { return t.output }
+func (t *benchTask) Timeout() time.Duration                                         { return time.Second }
+func (t *benchTask) Execute(ctx context.Context, collection *benchCollection) error { return nil }
+func (t *benchTask) Stateless() bool                                                { return true }
+
+// newBenchSnapshot builds layers of 10 tasks, each task depends on two tasks of the previous layer.
+// Every task outputs its own type [i]byte, the last layer's outputs are the targets.
+func newBenchSnapshot(b *testing.B, size int) (*Snapshot[*benchCollection], *benchCollection) {
+	const width = 10
+	outputs := make([]reflect.Type, size)
+	for i := range outputs {
+		outputs[i] = reflect.ArrayOf(i, reflect.TypeOf(byte(0)))
+	}
+	factory := NewFactory[*benchCollection]()
+	for i := 0; i < size; i++ {
+		task := &benchTask{name: fmt.Sprintf("task%04d", i), inputs: []reflect.Type{nil}, output: outputs[i]}
+		if i >= width {
+			layer := i / width * width
+			task.inputs = []reflect.Type{
+				outputs[layer-width+i%width],
+				outputs[layer-width+(i+1)%width],
+			}
+		}
+		if err := factory.RegisterTask(func() (ITask[*benchCollection], error) { return task, nil }); err != nil {
+			b.Fatal(err)
+		}
+	}
+	if err := factory.CreateGraph(); err != nil {
+		b.Fatal(err)
+	}
+	snapshot, err := factory.Snapshot()
+	if err != nil {
+		b.Fatal(err)
+	}
+	start := (size - 1) / width * width
+	return snapshot, &benchCollection{targets: outputs[start:]}
+}
+
+func benchmarkSizes(b *testing.B, run func(b *testing.B, snapshot *Snapshot[*benchCollection], collection *benchCollection)) {
+	for _, size := range []int{10, 100, 1000} {
+		b.Run(fmt.Sprintf("tasks=%d", size), func(b *testing.B) {
+			snapshot, collection := newBenchSnapshot(b, size)
+			b.ReportAllocs()
+			b.ResetTimer()
+			run(b, snapshot, collection)
+		})
+	}
+}
+
+// BenchmarkCreateTaskDagflow measures pruning the graph and creating a flow for a collection
+func BenchmarkCreateTaskDagflow(b *testing.B) {
+	benchmarkSizes(b, func(b *testing.B, snapshot *Snapshot[*benchCollection], collection *benchCollection) {
+		for i := 0; i < b.N; i++ {
+			if _, err := snapshot.CreateTaskDagflow(collection); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkExecute measures one run: creating the flow and executing it
+func BenchmarkExecute(b *testing.B) {
+	benchmarkSizes(b, func(b *testing.B, snapshot *Snapshot[*benchCollection], collection *benchCollection) {
+		for i := 0; i < b.N; i++ {
+			flow, err := snapshot.CreateTaskDagflow(collection)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if err := flow.Execute(context.Background(), 10*time.Second); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkExecuteSequential measures one sequential run, without goroutine scheduling
+func BenchmarkExecuteSequential(b *testing.B) {
+	benchmarkSizes(b, func(b *testing.B, snapshot *Snapshot[*benchCollection], collection *benchCollection) {
+		for i := 0; i < b.N; i++ {
+			flow, err := snapshot.CreateTaskDagflow(collection)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if err := flow.ExecuteSequential(context.Background(), 10*time.Second, nil); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
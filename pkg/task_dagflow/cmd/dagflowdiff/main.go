@@ -0,0 +1,68 @@
+// Command dagflowdiff compares two task_dagflow graph specs exported as json, e.g. by json.Marshal(factory.GraphSpec()),
+// and prints the added, removed and changed tasks and the targets whose producing chain changed.
+//
+// Usage in CI, to comment on PRs touching flow registration:
+//
+//	go run github.com/Steve-Lee-CST/go-pico-tool/pkg/task_dagflow/cmd/dagflowdiff -old base.json -new head.json
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/Steve-Lee-CST/go-pico-tool/pkg/task_dagflow"
+)
+
+func main() {
+	oldPath := flag.String("old", "", "path of the json spec before the change")
+	newPath := flag.String("new", "", "path of the json spec after the change")
+	jsonOutput := flag.Bool("json", false, "print the diff as json instead of text")
+	exitCode := flag.Bool("exit-code", false, "exit with status 1 if the specs differ")
+	flag.Parse()
+
+	diff, err := run(*oldPath, *newPath, *jsonOutput)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "dagflowdiff: %v\n", err)
+		os.Exit(2)
+	}
+	if *exitCode && !diff.Empty() {
+		os.Exit(1)
+	}
+}
+
+func run(oldPath string, newPath string, jsonOutput bool) (task_dagflow.GraphDiff, error) {
+	if oldPath == "" || newPath == "" {
+		return task_dagflow.GraphDiff{}, fmt.Errorf("-old and -new are required")
+	}
+	oldSpec, err := loadSpec(oldPath)
+	if err != nil {
+		return task_dagflow.GraphDiff{}, err
+	}
+	newSpec, err := loadSpec(newPath)
+	if err != nil {
+		return task_dagflow.GraphDiff{}, err
+	}
+
+	diff := task_dagflow.DiffGraphSpecs(oldSpec, newSpec)
+	if !jsonOutput {
+		_, err = fmt.Print(diff)
+		return diff, err
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return diff, encoder.Encode(diff)
+}
+
+func loadSpec(path string) (task_dagflow.GraphSpec, error) {
+	var spec task_dagflow.GraphSpec
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return spec, err
+	}
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return spec, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return spec, nil
+}
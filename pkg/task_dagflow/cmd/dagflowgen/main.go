@@ -0,0 +1,44 @@
+// Command dagflowgen generates a task_dagflow collection and its task interfaces from a json spec.
+//
+// Usage in a go file next to the spec:
+//
+//	//go:generate go run github.com/Steve-Lee-CST/go-pico-tool/pkg/task_dagflow/cmd/dagflowgen -spec flow.json -out flow_gen.go
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/Steve-Lee-CST/go-pico-tool/pkg/task_dagflow/dagflowgen"
+)
+
+func main() {
+	specPath := flag.String("spec", "", "path of the json spec")
+	outPath := flag.String("out", "", "path of the generated file, stdout if empty")
+	flag.Parse()
+
+	if err := run(*specPath, *outPath); err != nil {
+		fmt.Fprintf(os.Stderr, "dagflowgen: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(specPath string, outPath string) error {
+	if specPath == "" {
+		return fmt.Errorf("-spec is required")
+	}
+	spec, err := dagflowgen.LoadSpec(specPath)
+	if err != nil {
+		return err
+	}
+	source, err := dagflowgen.NewGenerator(dagflowgen.GetDefaultConfig()).Generate(spec)
+	if err != nil {
+		return err
+	}
+	if outPath == "" {
+		_, err = os.Stdout.Write(source)
+		return err
+	}
+	return os.WriteFile(outPath, source, 0o644)
+}
@@ -0,0 +1,64 @@
+package task_dagflow
+
+import (
+	"context"
+	"errors"
+)
+
+// Compensation undoes the side effects of a task when the run fails after the task succeeded,
+// e.g. cancels a reservation whose id the task wrote to the collection
+type Compensation[CT ICollection] func(ctx context.Context, collection CT) error
+
+// WithCompensation declares the compensation of the task. When a run fails, compensations of the tasks
+// which succeeded in the run are called one at a time in reverse completion order, so a task is compensated
+// after every task consuming its output. The failed task is not compensated; a failed run of a flow with
+// compensations waits for its running tasks to return, and those succeeding meanwhile are compensated too.
+//
+// Compensations run after the flow ctx is canceled: they get a ctx keeping its values with the task timeout.
+// Their failures are recorded in the task reports and joined to the error of the run as *CompensationError.
+func WithCompensation[CT ICollection](compensation Compensation[CT]) TaskOption[CT] {
+	return func(meta *taskMeta[CT]) {
+		meta.Compensation = compensation
+	}
+}
+
+// compensate calls the compensations of the tasks which succeeded in the failed run, err is the error of the run
+func (t *TaskDagflow[CT]) compensate(ctx context.Context, recorder *runRecorder[CT], err error) error {
+	errs := []error{err}
+	succeeded := recorder.Succeeded()
+	for i := len(succeeded) - 1; i >= 0; i-- {
+		index := succeeded[i]
+		producer := t.tasks[index].producer(recorder.reports[index].Producer)
+		if producer == nil || producer.Meta.Compensation == nil {
+			continue
+		}
+		compensationErr := producer.compensate(ctx, t.collection)
+		recorder.TaskCompensated(index, compensationErr)
+		if compensationErr != nil {
+			errs = append(errs, &CompensationError{
+				TaskName: producer.Meta.Name, OutputType: producer.Meta.OutputType, Err: compensationErr,
+			})
+		}
+	}
+	if len(errs) == 1 {
+		return err
+	}
+	return errors.Join(errs...)
+}
+
+// producer returns the producer of the task with the name, nil if there is none
+func (te *taskExecutor[CT]) producer(name string) *taskProducer[CT] {
+	for _, producer := range te.Producers {
+		if producer.Meta.Name == name {
+			return producer
+		}
+	}
+	return nil
+}
+
+func (tp *taskProducer[CT]) compensate(ctx context.Context, collection CT) (err error) {
+	subCtx, cancel := context.WithTimeout(tp.withMetadata(context.WithoutCancel(ctx)), tp.Meta.Timeout)
+	defer cancel()
+	defer tp.recoverPanic(&err)
+	return tp.Meta.Compensation(subCtx, collection)
+}
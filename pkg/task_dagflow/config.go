@@ -0,0 +1,23 @@
+package task_dagflow
+
+type Config struct {
+	// Name identifies the factory and the flows created by it in reports and debug pages
+	Name string
+	// CheckContract enables checked mode for tests and staging: tasks run one at a time,
+	// their collection accesses are recorded and verified against InputTypes()/OutputType().
+	// The collection must embed AccessTracker.
+	CheckContract bool
+	// Sequential runs ready tasks one at a time in a stable order on the caller's goroutine,
+	// so every run of the same flow is identical, see TaskDagflow.ExecuteSequential
+	Sequential bool
+	// Deps is passed to task constructors registered by RegisterConstructor, a new empty container if nil
+	Deps *Deps
+}
+
+var defaultConfig = Config{
+	Name: "task_dagflow",
+}
+
+func GetDefaultConfig() Config {
+	return defaultConfig
+}
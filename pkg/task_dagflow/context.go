@@ -0,0 +1,92 @@
+package task_dagflow
+
+import (
+	"context"
+
+	"github.com/Steve-Lee-CST/go-pico-tool/pkg/id_generator"
+)
+
+// TaskMetadata describes the task a context was passed to, for logs and calls to downstream services
+type TaskMetadata struct {
+	FlowName string
+	TaskName string
+	// Attempt is 1 for the primary task, 2 for its first fallback and so on
+	Attempt int
+	// RunID identifies one execution of a flow, RunReport.RunID records it
+	RunID string
+	// RequestID is set by WithRequestID on the ctx passed to Execute, empty if absent
+	RequestID string
+}
+
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	runIDKey
+	taskMetadataKey
+)
+
+var runIDGenerator = id_generator.NewIDGenerator(id_generator.GetDefaultConfig())
+
+// WithRequestID attaches the request id to the ctx passed to Execute, every task of the run sees it
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey, requestID)
+}
+
+// WithRunID sets the run id of executions with ctx, a new id is generated for each run otherwise
+func WithRunID(ctx context.Context, runID string) context.Context {
+	return context.WithValue(ctx, runIDKey, runID)
+}
+
+// TaskMetadataFromContext returns the metadata of the task ctx was passed to,
+// false if ctx does not come from a task, e.g. outside of Execute
+func TaskMetadataFromContext(ctx context.Context) (TaskMetadata, bool) {
+	metadata, ok := ctx.Value(taskMetadataKey).(TaskMetadata)
+	return metadata, ok
+}
+
+func FlowNameFromContext(ctx context.Context) string {
+	metadata, _ := TaskMetadataFromContext(ctx)
+	return metadata.FlowName
+}
+
+func TaskNameFromContext(ctx context.Context) string {
+	metadata, _ := TaskMetadataFromContext(ctx)
+	return metadata.TaskName
+}
+
+// AttemptFromContext returns the attempt of the task, 0 outside of a task
+func AttemptFromContext(ctx context.Context) int {
+	metadata, _ := TaskMetadataFromContext(ctx)
+	return metadata.Attempt
+}
+
+func RunIDFromContext(ctx context.Context) string {
+	runID, _ := ctx.Value(runIDKey).(string)
+	return runID
+}
+
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey).(string)
+	return requestID
+}
+
+// withRunID makes sure ctx carries a run id, generating one if the caller did not set it
+func withRunID(ctx context.Context) (context.Context, string) {
+	if runID := RunIDFromContext(ctx); runID != "" {
+		return ctx, runID
+	}
+	runID := runIDGenerator.Generate()
+	return WithRunID(ctx, runID), runID
+}
+
+// withMetadata returns the ctx passed to the producer's interceptors and task
+func (tp *taskProducer[CT]) withMetadata(ctx context.Context) context.Context {
+	return context.WithValue(ctx, taskMetadataKey, TaskMetadata{
+		FlowName:  tp.FlowName,
+		TaskName:  tp.Meta.Name,
+		Attempt:   tp.Attempt,
+		RunID:     RunIDFromContext(ctx),
+		RequestID: RequestIDFromContext(ctx),
+	})
+}
@@ -0,0 +1,197 @@
+package task_dagflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	mapset "github.com/deckarep/golang-set/v2"
+)
+
+// ErrContractViolation is matched by every *ContractViolationError with errors.Is
+var ErrContractViolation = errors.New("task contract violation")
+
+// ContractViolationError: in checked mode, a task accessed collection values it didn't declare
+// in InputTypes()/OutputType(), or returned without setting its declared output.
+type ContractViolationError struct {
+	TaskName         string
+	UndeclaredReads  []reflect.Type
+	UndeclaredWrites []reflect.Type
+	OutputNotSet     reflect.Type
+}
+
+func (e *ContractViolationError) Error() string {
+	parts := make([]string, 0, 3)
+	if len(e.UndeclaredReads) > 0 {
+		parts = append(parts, fmt.Sprintf("undeclared reads %v", e.UndeclaredReads))
+	}
+	if len(e.UndeclaredWrites) > 0 {
+		parts = append(parts, fmt.Sprintf("undeclared writes %v", e.UndeclaredWrites))
+	}
+	if e.OutputNotSet != nil {
+		parts = append(parts, fmt.Sprintf("declared output %s not set", e.OutputNotSet))
+	}
+	return fmt.Sprintf("task %s violates its contract: %s", e.TaskName, strings.Join(parts, ", "))
+}
+
+func (e *ContractViolationError) Is(target error) bool {
+	return target == ErrContractViolation
+}
+
+// IAccessTracked is implemented by collections embedding AccessTracker
+type IAccessTracked interface {
+	accessTracker() *AccessTracker
+}
+
+// TaskAccess lists the collection value types a task actually read and wrote
+type TaskAccess struct {
+	Reads  []reflect.Type
+	Writes []reflect.Type
+}
+
+type trackedTask struct {
+	name   string
+	reads  mapset.Set[reflect.Type]
+	writes mapset.Set[reflect.Type]
+}
+
+// AccessTracker records collection accesses of tasks in checked mode (Config.CheckContract).
+// Embed it in the collection and report accesses from getters and setters:
+//
+//	type DataCollection struct {
+//		task_dagflow.AccessTracker
+//		goods []Goods
+//	}
+//	func (c *DataCollection) GetGoods() []Goods { return task_dagflow.TrackedGet(&c.AccessTracker, c.goods) }
+//	func (c *DataCollection) SetGoods(goods []Goods) { task_dagflow.TrackedSet(&c.AccessTracker, &c.goods, goods) }
+//
+// Outside checked mode tracking costs a mutex, checked mode runs tasks one at a time so that
+// every access is attributed to the running task.
+type AccessTracker struct {
+	execLock sync.Mutex
+	lock     sync.Mutex
+	current  *trackedTask
+	accesses map[string]TaskAccess
+}
+
+func (t *AccessTracker) accessTracker() *AccessTracker {
+	return t
+}
+
+func (t *AccessTracker) TrackRead(valueType reflect.Type) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.current != nil {
+		t.current.reads.Add(valueType)
+	}
+}
+
+func (t *AccessTracker) TrackWrite(valueType reflect.Type) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.current != nil {
+		t.current.writes.Add(valueType)
+	}
+}
+
+// Accesses returns what each task accessed in checked mode, keyed by task name
+func (t *AccessTracker) Accesses() map[string]TaskAccess {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	accesses := make(map[string]TaskAccess, len(t.accesses))
+	for name, access := range t.accesses {
+		accesses[name] = access
+	}
+	return accesses
+}
+
+// TrackedGet records a read of T and returns value
+func TrackedGet[T any](tracker *AccessTracker, value T) T {
+	tracker.TrackRead(reflect.TypeOf((*T)(nil)).Elem())
+	return value
+}
+
+// TrackedSet records a write of T and stores value into target
+func TrackedSet[T any](tracker *AccessTracker, target *T, value T) {
+	tracker.TrackWrite(reflect.TypeOf((*T)(nil)).Elem())
+	*target = value
+}
+
+func (t *AccessTracker) begin(name string) {
+	t.execLock.Lock()
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.current = &trackedTask{
+		name:   name,
+		reads:  mapset.NewThreadUnsafeSet[reflect.Type](),
+		writes: mapset.NewThreadUnsafeSet[reflect.Type](),
+	}
+}
+
+func (t *AccessTracker) end() *trackedTask {
+	defer t.execLock.Unlock()
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	current := t.current
+	t.current = nil
+	if t.accesses == nil {
+		t.accesses = make(map[string]TaskAccess)
+	}
+	t.accesses[current.name] = TaskAccess{
+		Reads:  sortedTypes(current.reads),
+		Writes: sortedTypes(current.writes),
+	}
+	return current
+}
+
+// checked runs handler alone, with its accesses recorded and verified against the declared types
+func (t *AccessTracker) checked(
+	name string, inputTypes mapset.Set[reflect.Type], outputType reflect.Type, handler func() error,
+) error {
+	t.begin(name)
+	err := handler()
+	current := t.end()
+
+	violation := &ContractViolationError{TaskName: name}
+	for _, readType := range sortedTypes(current.reads) {
+		if !inputTypes.Contains(readType) {
+			violation.UndeclaredReads = append(violation.UndeclaredReads, readType)
+		}
+	}
+	for _, writeType := range sortedTypes(current.writes) {
+		if writeType != outputType {
+			violation.UndeclaredWrites = append(violation.UndeclaredWrites, writeType)
+		}
+	}
+	if err == nil && !current.writes.Contains(outputType) {
+		violation.OutputNotSet = outputType
+	}
+	if len(violation.UndeclaredReads) == 0 && len(violation.UndeclaredWrites) == 0 && violation.OutputNotSet == nil {
+		return err
+	}
+	if err != nil {
+		return errors.Join(violation, err)
+	}
+	return violation
+}
+
+func sortedTypes(types mapset.Set[reflect.Type]) []reflect.Type {
+	result := types.ToSlice()
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].String() < result[j].String()
+	})
+	return result
+}
+
+// contractHandler wraps the task itself in checked mode, inside all interceptors
+func contractHandler[CT ICollection](tracker *AccessTracker, meta *taskMeta[CT], handler TaskHandler[CT]) TaskHandler[CT] {
+	return func(ctx context.Context, collection CT) error {
+		return tracker.checked(meta.Name, meta.InputTypes, meta.OutputType, func() error {
+			return handler(ctx, collection)
+		})
+	}
+}
@@ -0,0 +1,18 @@
+package dagflowgen
+
+type Config struct {
+	// DagflowImport is the import path of the task_dagflow package used by generated code,
+	// it is imported as task_dagflow whatever its path
+	DagflowImport string
+	// Generator is the name written in the "Code generated by" header
+	Generator string
+}
+
+var defaultConfig = Config{
+	DagflowImport: "github.com/Steve-Lee-CST/go-pico-tool/pkg/task_dagflow",
+	Generator:     "dagflowgen",
+}
+
+func GetDefaultConfig() Config {
+	return defaultConfig
+}
@@ -0,0 +1,37 @@
+package dagflowgen
+
+import (
+	"go/token"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+func isIdentifier(name string) bool {
+	return token.IsIdentifier(name)
+}
+
+func isExportedIdentifier(name string) bool {
+	return token.IsIdentifier(name) && token.IsExported(name)
+}
+
+// fieldName returns the unexported struct field name for an exported field name,
+// avoiding keywords and the receiver name `c`
+func fieldName(name string) string {
+	r, size := utf8.DecodeRuneInString(name)
+	lowered := string(unicode.ToLower(r)) + name[size:]
+	if token.IsKeyword(lowered) || lowered == "c" {
+		lowered += "Value"
+	}
+	return lowered
+}
+
+// interfaceName returns the default interface name of a task: GetGoodsTask -> IGetGoods
+func interfaceName(taskName string) string {
+	return "I" + strings.TrimSuffix(taskName, "Task")
+}
+
+func sameInterface(a, b modelInterface) bool {
+	return a.Output == b.Output && slices.Equal(a.Inputs, b.Inputs)
+}
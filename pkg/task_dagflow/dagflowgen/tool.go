@@ -0,0 +1,283 @@
+package dagflowgen
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"os"
+	"text/template"
+)
+
+// Spec describes a collection and the tasks using it.
+// Fields are referenced by name everywhere else in the spec.
+type Spec struct {
+	// Package is the package name of the generated file
+	Package string `json:"package"`
+	// Imports are extra import paths needed by field types, e.g. "time"
+	Imports []string `json:"imports,omitempty"`
+	// Collection is the name of the generated collection struct
+	Collection string `json:"collection"`
+	// Tracked embeds task_dagflow.AccessTracker into the collection for checked mode
+	Tracked bool `json:"tracked,omitempty"`
+	// Inputs are fields available at the start of the flow, Targets are fields the flow must produce
+	Inputs  []string `json:"inputs,omitempty"`
+	Targets []string `json:"targets"`
+	Fields  []Field  `json:"fields"`
+	Tasks   []Task   `json:"tasks"`
+}
+
+// Field is a value of the collection: `GetName() Type` and `SetName(Type)` are generated for it
+type Field struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// Task is a task using the collection, a narrow interface with the getters of its inputs
+// and the setter of its output is generated for it
+type Task struct {
+	Name string `json:"name"`
+	// Interface defaults to "I" + Name without the "Task" suffix
+	Interface string   `json:"interface,omitempty"`
+	Inputs    []string `json:"inputs,omitempty"`
+	Output    string   `json:"output"`
+}
+
+// LoadSpec reads a json spec file
+func LoadSpec(path string) (*Spec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	spec := &Spec{}
+	if err := json.Unmarshal(data, spec); err != nil {
+		return nil, fmt.Errorf("failed to parse spec %s: %w", path, err)
+	}
+	return spec, nil
+}
+
+type Generator struct {
+	config Config
+}
+
+func NewGenerator(config Config) *Generator {
+	return &Generator{config: config}
+}
+
+// Generate returns the gofmt-ed source of the collection, its narrow interfaces and compile-time assertions
+func (g *Generator) Generate(spec *Spec) ([]byte, error) {
+	model, err := g.newModel(spec)
+	if err != nil {
+		return nil, err
+	}
+	buf := &bytes.Buffer{}
+	if err := sourceTemplate.Execute(buf, model); err != nil {
+		return nil, err
+	}
+	source, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("generated invalid source: %w", err)
+	}
+	return source, nil
+}
+
+// model is the validated spec in the shape used by sourceTemplate
+type model struct {
+	Generator     string
+	Package       string
+	Imports       []string
+	DagflowImport string
+	Collection    string
+	Tracked       bool
+	Fields        []modelField
+	Inputs        []modelField
+	Targets       []modelField
+	Interfaces    []modelInterface
+}
+
+type modelField struct {
+	Name      string
+	Type      string
+	FieldName string
+}
+
+type modelInterface struct {
+	Name   string
+	Tasks  []string
+	Inputs []modelField
+	Output modelField
+}
+
+func (g *Generator) newModel(spec *Spec) (*model, error) {
+	if !isIdentifier(spec.Package) {
+		return nil, fmt.Errorf("invalid package name %q", spec.Package)
+	}
+	if !isExportedIdentifier(spec.Collection) {
+		return nil, fmt.Errorf("invalid collection name %q", spec.Collection)
+	}
+	m := &model{
+		Generator:     g.config.Generator,
+		Package:       spec.Package,
+		Imports:       spec.Imports,
+		DagflowImport: g.config.DagflowImport,
+		Collection:    spec.Collection,
+		Tracked:       spec.Tracked,
+	}
+
+	fields := make(map[string]modelField, len(spec.Fields))
+	// values are keyed by type in a flow, so each field needs its own type
+	types := make(map[string]string, len(spec.Fields))
+	for _, field := range spec.Fields {
+		if !isExportedIdentifier(field.Name) {
+			return nil, fmt.Errorf("invalid field name %q", field.Name)
+		}
+		if field.Type == "" {
+			return nil, fmt.Errorf("field %s has no type", field.Name)
+		}
+		if _, ok := fields[field.Name]; ok {
+			return nil, fmt.Errorf("duplicate field %s", field.Name)
+		}
+		if other, ok := types[field.Type]; ok {
+			return nil, fmt.Errorf("fields %s and %s have the same type %s", other, field.Name, field.Type)
+		}
+		types[field.Type] = field.Name
+		modelField := modelField{Name: field.Name, Type: field.Type, FieldName: fieldName(field.Name)}
+		fields[field.Name] = modelField
+		m.Fields = append(m.Fields, modelField)
+	}
+	lookup := func(owner string, names []string) ([]modelField, error) {
+		result := make([]modelField, 0, len(names))
+		for _, name := range names {
+			field, ok := fields[name]
+			if !ok {
+				return nil, fmt.Errorf("%s references unknown field %s", owner, name)
+			}
+			result = append(result, field)
+		}
+		return result, nil
+	}
+
+	var err error
+	if m.Inputs, err = lookup("inputs", spec.Inputs); err != nil {
+		return nil, err
+	}
+	if m.Targets, err = lookup("targets", spec.Targets); err != nil {
+		return nil, err
+	}
+	if len(m.Targets) == 0 {
+		return nil, fmt.Errorf("collection %s has no targets", spec.Collection)
+	}
+
+	interfaces := make(map[string]int, len(spec.Tasks))
+	for _, task := range spec.Tasks {
+		iface := modelInterface{Name: task.Interface, Tasks: []string{task.Name}}
+		if iface.Name == "" {
+			iface.Name = interfaceName(task.Name)
+		}
+		if !isExportedIdentifier(iface.Name) {
+			return nil, fmt.Errorf("task %s: invalid interface name %q", task.Name, iface.Name)
+		}
+		if iface.Inputs, err = lookup("task "+task.Name, task.Inputs); err != nil {
+			return nil, err
+		}
+		outputs, err := lookup("task "+task.Name, []string{task.Output})
+		if err != nil {
+			return nil, err
+		}
+		iface.Output = outputs[0]
+		for _, input := range iface.Inputs {
+			if input.Name == iface.Output.Name {
+				return nil, fmt.Errorf("task %s: %s is both input and output", task.Name, input.Name)
+			}
+		}
+
+		// tasks sharing an interface, e.g. fallbacks, must agree on it
+		if i, ok := interfaces[iface.Name]; ok {
+			if !sameInterface(m.Interfaces[i], iface) {
+				return nil, fmt.Errorf("task %s: interface %s is declared differently by %v",
+					task.Name, iface.Name, m.Interfaces[i].Tasks)
+			}
+			m.Interfaces[i].Tasks = append(m.Interfaces[i].Tasks, task.Name)
+			continue
+		}
+		interfaces[iface.Name] = len(m.Interfaces)
+		m.Interfaces = append(m.Interfaces, iface)
+	}
+	return m, nil
+}
+
+var sourceTemplate = template.Must(template.New("dagflowgen").Parse(`// Code generated by {{.Generator}}. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"reflect"
+{{- range .Imports}}
+	"{{.}}"
+{{- end}}
+
+	task_dagflow "{{.DagflowImport}}"
+)
+
+type {{.Collection}} struct {
+{{- if .Tracked}}
+	task_dagflow.AccessTracker
+{{end}}
+{{- range .Fields}}
+	{{.FieldName}} {{.Type}}
+{{- end}}
+}
+
+func (c *{{.Collection}}) InputTypes() []reflect.Type {
+{{- if .Inputs}}
+	return []reflect.Type{
+	{{- range .Inputs}}
+		reflect.TypeOf((*{{.Type}})(nil)).Elem(),
+	{{- end}}
+	}
+{{- else}}
+	return []reflect.Type{nil}
+{{- end}}
+}
+
+func (c *{{.Collection}}) TargetTypes() []reflect.Type {
+	return []reflect.Type{
+	{{- range .Targets}}
+		reflect.TypeOf((*{{.Type}})(nil)).Elem(),
+	{{- end}}
+	}
+}
+{{range .Fields}}
+func (c *{{$.Collection}}) Get{{.Name}}() {{.Type}} {
+{{- if $.Tracked}}
+	return task_dagflow.TrackedGet(&c.AccessTracker, c.{{.FieldName}})
+{{- else}}
+	return c.{{.FieldName}}
+{{- end}}
+}
+
+func (c *{{$.Collection}}) Set{{.Name}}({{.FieldName}} {{.Type}}) {
+{{- if $.Tracked}}
+	task_dagflow.TrackedSet(&c.AccessTracker, &c.{{.FieldName}}, {{.FieldName}})
+{{- else}}
+	c.{{.FieldName}} = {{.FieldName}}
+{{- end}}
+}
+{{end}}
+{{- range .Interfaces}}
+// {{.Name}} is the collection seen by {{range $i, $task := .Tasks}}{{if $i}}, {{end}}{{$task}}{{end}}
+type {{.Name}} interface {
+	task_dagflow.ICollection
+{{- range .Inputs}}
+	Get{{.Name}}() {{.Type}}
+{{- end}}
+	Set{{.Output.Name}}({{.Output.FieldName}} {{.Output.Type}})
+}
+{{end}}
+var (
+	_ task_dagflow.ICollection = (*{{.Collection}})(nil)
+{{- range .Interfaces}}
+	_ {{.Name}} = (*{{$.Collection}})(nil)
+{{- end}}
+)
+`))
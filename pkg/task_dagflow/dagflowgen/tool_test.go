@@ -0,0 +1,139 @@
+package dagflowgen
+
+import (
+	"flag"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+type importerFunc func(path string) (*types.Package, error)
+
+func (f importerFunc) Import(path string) (*types.Package, error) { return f(path) }
+
+// typeCheck type-checks the generated source along with stubs declaring the types it references,
+// dagflowImport resolves to the task_dagflow package of this module
+func typeCheck(t *testing.T, source []byte, stubs string, dagflowImport string) {
+	t.Helper()
+	fset := token.NewFileSet()
+	files := make([]*ast.File, 0, 2)
+	for name, src := range map[string]string{"generated.go": string(source), "stubs.go": stubs} {
+		file, err := parser.ParseFile(fset, name, src, 0)
+		if err != nil {
+			t.Fatalf("failed to parse %s: %v", name, err)
+		}
+		files = append(files, file)
+	}
+	sourceImporter := importer.ForCompiler(fset, "source", nil)
+	config := types.Config{Importer: importerFunc(func(path string) (*types.Package, error) {
+		if path == dagflowImport {
+			path = GetDefaultConfig().DagflowImport
+		}
+		return sourceImporter.Import(path)
+	})}
+	if _, err := config.Check(files[0].Name.Name, fset, files, nil); err != nil {
+		t.Fatalf("generated source does not type-check: %v\n%s", err, source)
+	}
+}
+
+func TestGenerator_Golden(t *testing.T) {
+	spec, err := LoadSpec("testdata/goods_in_shops.json")
+	if err != nil {
+		t.Fatalf("failed to load spec: %v", err)
+	}
+	source, err := NewGenerator(GetDefaultConfig()).Generate(spec)
+	if err != nil {
+		t.Fatalf("failed to generate: %v", err)
+	}
+
+	golden := "testdata/goods_in_shops.golden"
+	if *update {
+		if err := os.WriteFile(golden, source, 0o644); err != nil {
+			t.Fatalf("failed to update golden file: %v", err)
+		}
+	}
+	expected, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("failed to read golden file: %v", err)
+	}
+	if string(source) != string(expected) {
+		t.Errorf("generated source differs from %s, run `go test -update` if intended:\n%s", golden, source)
+	}
+	typeCheck(t, source, "package shop\n\ntype Shop struct{}\ntype Goods struct{}\ntype GoodsInShops struct{}\n",
+		GetDefaultConfig().DagflowImport)
+}
+
+func TestGenerator_Untracked(t *testing.T) {
+	spec := &Spec{
+		Package:    "demo",
+		Collection: "DemoCollection",
+		Targets:    []string{"Result"},
+		Fields:     []Field{{Name: "Type", Type: "string"}, {Name: "Result", Type: "int"}},
+		Tasks:      []Task{{Name: "ResultTask", Inputs: []string{"Type"}, Output: "Result"}},
+	}
+	// a vendored or forked task_dagflow keeps the qualifier of the generated code
+	config := GetDefaultConfig()
+	config.DagflowImport = "example.com/fork/dagflow/v2"
+	source, err := NewGenerator(config).Generate(spec)
+	if err != nil {
+		t.Fatalf("failed to generate: %v", err)
+	}
+	typeCheck(t, source, "package demo\n", config.DagflowImport)
+	for _, expected := range []string{
+		`task_dagflow "example.com/fork/dagflow/v2"`,
+		"return []reflect.Type{nil}",
+		"func (c *DemoCollection) SetType(typeValue string) {",
+		"type IResult interface {",
+		"_ IResult                  = (*DemoCollection)(nil)",
+	} {
+		if !strings.Contains(string(source), expected) {
+			t.Errorf("expected generated source to contain %q:\n%s", expected, source)
+		}
+	}
+	if strings.Contains(string(source), "AccessTracker") {
+		t.Error("untracked collection should not embed AccessTracker")
+	}
+}
+
+func TestGenerator_InvalidSpec(t *testing.T) {
+	valid := func() *Spec {
+		return &Spec{
+			Package:    "demo",
+			Collection: "DemoCollection",
+			Targets:    []string{"Result"},
+			Fields:     []Field{{Name: "Source", Type: "string"}, {Name: "Result", Type: "int"}},
+			Tasks: []Task{
+				{Name: "ResultTask", Inputs: []string{"Source"}, Output: "Result"},
+				{Name: "SourceTask", Output: "Source"},
+			},
+		}
+	}
+	cases := map[string]func(spec *Spec){
+		"invalid package":       func(spec *Spec) { spec.Package = "not a package" },
+		"unexported collection": func(spec *Spec) { spec.Collection = "demoCollection" },
+		"duplicate field":       func(spec *Spec) { spec.Fields = append(spec.Fields, Field{Name: "Result", Type: "bool"}) },
+		"duplicate type":        func(spec *Spec) { spec.Fields = append(spec.Fields, Field{Name: "Other", Type: "int"}) },
+		"no targets":            func(spec *Spec) { spec.Targets = nil },
+		"unknown target":        func(spec *Spec) { spec.Targets = []string{"Missing"} },
+		"unknown task input":    func(spec *Spec) { spec.Tasks[0].Inputs = []string{"Missing"} },
+		"input is output":       func(spec *Spec) { spec.Tasks[0].Inputs = []string{"Result"} },
+		"conflicting interface": func(spec *Spec) { spec.Tasks[1].Interface = "IResult" },
+	}
+	for name, modify := range cases {
+		spec := valid()
+		modify(spec)
+		if _, err := NewGenerator(GetDefaultConfig()).Generate(spec); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if _, err := NewGenerator(GetDefaultConfig()).Generate(valid()); err != nil {
+		t.Errorf("expected valid spec to generate, got %v", err)
+	}
+}
@@ -0,0 +1,18 @@
+package dagflowhistory
+
+type Config struct {
+	// Capacity is the number of runs kept in memory, the oldest run is dropped when full
+	Capacity int
+	// FilePath is the append-only json-lines file runs are written to, runs are kept in memory only if empty.
+	// Runs already in the file are loaded when the history is opened.
+	FilePath string
+}
+
+var defaultConfig = Config{
+	Capacity: 1000,
+	FilePath: "",
+}
+
+func GetDefaultConfig() Config {
+	return defaultConfig
+}
@@ -0,0 +1,108 @@
+package dagflowhistory
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"time"
+
+	"github.com/Steve-Lee-CST/go-pico-tool/pkg/task_dagflow"
+)
+
+type helper struct{}
+
+var Helper = helper{}
+
+// MatchRun reports whether the run matches the run-level conditions of the query
+func (h helper) MatchRun(query Query, report *task_dagflow.RunReport) bool {
+	if query.FlowName != "" && report.FlowName != query.FlowName {
+		return false
+	}
+	if !query.Since.IsZero() && report.StartTime.Before(query.Since) {
+		return false
+	}
+	if !query.Until.IsZero() && !report.StartTime.Before(query.Until) {
+		return false
+	}
+	if query.Status != "" && report.Status != query.Status {
+		return false
+	}
+	return true
+}
+
+// MatchTask reports whether the task matches the task-level conditions of the query,
+// a task is matched by its name or by the fallback which produced its value
+func (h helper) MatchTask(query Query, task *task_dagflow.TaskReport) bool {
+	if query.Task != "" && task.Name != query.Task && task.Producer != query.Task {
+		return false
+	}
+	if query.TaskStatus != "" && task.Status != query.TaskStatus {
+		return false
+	}
+	if query.TimedOut && !task.TimedOut {
+		return false
+	}
+	return true
+}
+
+// hasTaskConditions reports whether runs must contain a task matching the query
+func (h helper) hasTaskConditions(query Query) bool {
+	return query.Task != "" || query.TaskStatus != "" || query.TimedOut
+}
+
+// ReadFile calls fn with every run of a history file in order. Lines which are not valid reports,
+// e.g. the last line of a process killed while writing, are skipped.
+func (h helper) ReadFile(path string, fn func(report *task_dagflow.RunReport)) error {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			report := &task_dagflow.RunReport{}
+			if json.Unmarshal(line, report) == nil {
+				fn(report)
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// terminateLastLine ends a partial last line, so the next run is not appended to it
+func (h helper) terminateLastLine(file *os.File) error {
+	info, err := file.Stat()
+	if err != nil || info.Size() == 0 {
+		return err
+	}
+	last := make([]byte, 1)
+	if _, err := file.ReadAt(last, info.Size()-1); err != nil {
+		return err
+	}
+	if last[0] == '\n' {
+		return nil
+	}
+	_, err = file.Write([]byte{'\n'})
+	return err
+}
+
+// averageDuration returns total / count, 0 if count is 0
+func averageDuration(total time.Duration, count int) time.Duration {
+	if count == 0 {
+		return 0
+	}
+	return total / time.Duration(count)
+}
@@ -0,0 +1,226 @@
+package dagflowhistory
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Steve-Lee-CST/go-pico-tool/pkg/task_dagflow"
+	"github.com/Steve-Lee-CST/go-pico-tool/tools"
+)
+
+// Query selects runs of a history, zero fields match everything
+type Query struct {
+	FlowName string
+	// Since and Until bound the start time of runs, Until is exclusive
+	Since time.Time
+	Until time.Time
+	// Status is the status of the run
+	Status task_dagflow.RunStatus
+	// Task, TaskStatus and TimedOut select tasks, runs without a selected task are skipped
+	Task       string
+	TaskStatus task_dagflow.TaskStatus
+	TimedOut   bool
+	// Limit is the maximum number of runs returned by Runs, no limit if <= 0
+	Limit int
+}
+
+// TaskStat aggregates the reports of one task among the queried runs
+type TaskStat struct {
+	Task       string `json:"task"`
+	Runs       int    `json:"runs"`
+	Succeeded  int    `json:"succeeded"`
+	Failed     int    `json:"failed"`
+	TimedOut   int    `json:"timed_out"`
+	Unfinished int    `json:"unfinished"`
+	Skipped    int    `json:"skipped"`
+	// Reused counts runs of TaskDagflow.Recompute keeping the task's previous output
+	Reused      int           `json:"reused,omitempty"`
+	AvgTimeCost time.Duration `json:"avg_time_cost"`
+	MaxTimeCost time.Duration `json:"max_time_cost"`
+	LastError   string        `json:"last_error,omitempty"`
+}
+
+// History keeps the last runs of flows in memory, and optionally appends them to a file
+type History struct {
+	config Config
+	lock   sync.RWMutex
+	runs   tools.RingBuffer[*task_dagflow.RunReport]
+	file   *os.File
+	err    error
+}
+
+// NewHistory opens the history, runs already in Config.FilePath are loaded
+func NewHistory(config Config) (*History, error) {
+	if config.Capacity <= 0 {
+		config.Capacity = GetDefaultConfig().Capacity
+	}
+	h := &History{
+		config: config,
+		runs:   tools.NewRingBuffer[*task_dagflow.RunReport](config.Capacity),
+	}
+	if config.FilePath == "" {
+		return h, nil
+	}
+	if err := Helper.ReadFile(config.FilePath, h.runs.Push); err != nil {
+		return nil, fmt.Errorf("failed to load history %s: %w", config.FilePath, err)
+	}
+	file, err := os.OpenFile(config.FilePath, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history %s: %w", config.FilePath, err)
+	}
+	if err := Helper.terminateLastLine(file); err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("failed to open history %s: %w", config.FilePath, err)
+	}
+	h.file = file
+	return h, nil
+}
+
+// Add records the run, the run is kept in memory even if writing the file fails
+func (h *History) Add(report *task_dagflow.RunReport) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.runs.Push(report)
+	if h.file == nil {
+		return nil
+	}
+	line, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	_, err = h.file.Write(append(line, '\n'))
+	return err
+}
+
+// Observe is a task_dagflow.RunObserver recording runs of a factory:
+//
+//	factory.AddRunObserver(history.Observe)
+//
+// The last error of writing the file is returned by Err.
+func (h *History) Observe(report *task_dagflow.RunReport) {
+	if err := h.Add(report); err != nil {
+		h.lock.Lock()
+		h.err = err
+		h.lock.Unlock()
+	}
+}
+
+// Err returns the last error of Observe, nil if none
+func (h *History) Err() error {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	return h.err
+}
+
+// Runs returns runs matching the query, newest first
+func (h *History) Runs(query Query) []*task_dagflow.RunReport {
+	all := h.snapshot()
+	result := make([]*task_dagflow.RunReport, 0)
+	for i := len(all) - 1; i >= 0; i-- {
+		if query.Limit > 0 && len(result) >= query.Limit {
+			break
+		}
+		if h.matchRun(query, all[i]) {
+			result = append(result, all[i])
+		}
+	}
+	return result
+}
+
+// TaskStats aggregates tasks matching the query by task name, sorted by name.
+// For example, how often did FetchTask time out in the last hour:
+//
+//	history.TaskStats(Query{Task: "FetchTask", Since: time.Now().Add(-time.Hour)})
+func (h *History) TaskStats(query Query) []TaskStat {
+	stats := make(map[string]*TaskStat)
+	totals := make(map[string]time.Duration)
+	for _, report := range h.snapshot() {
+		if !Helper.MatchRun(query, report) {
+			continue
+		}
+		for i := range report.Tasks {
+			task := &report.Tasks[i]
+			if !Helper.MatchTask(query, task) {
+				continue
+			}
+			stat, ok := stats[task.Name]
+			if !ok {
+				stat = &TaskStat{Task: task.Name}
+				stats[task.Name] = stat
+			}
+			stat.Runs++
+			switch task.Status {
+			case task_dagflow.TaskStatusSuccess:
+				stat.Succeeded++
+			case task_dagflow.TaskStatusFailed:
+				stat.Failed++
+				stat.LastError = task.Error
+			case task_dagflow.TaskStatusUnfinished:
+				stat.Unfinished++
+			case task_dagflow.TaskStatusSkipped:
+				stat.Skipped++
+			case task_dagflow.TaskStatusReused:
+				stat.Reused++
+			}
+			if task.TimedOut {
+				stat.TimedOut++
+			}
+			totals[task.Name] += task.TimeCost
+			stat.MaxTimeCost = max(stat.MaxTimeCost, task.TimeCost)
+		}
+	}
+
+	result := make([]TaskStat, 0, len(stats))
+	for name, stat := range stats {
+		stat.AvgTimeCost = averageDuration(totals[name], stat.Runs)
+		result = append(result, *stat)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Task < result[j].Task
+	})
+	return result
+}
+
+// Size returns the number of runs kept in memory
+func (h *History) Size() int {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	return h.runs.Size()
+}
+
+// Close closes the history file, runs added afterwards are kept in memory only
+func (h *History) Close() error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.file == nil {
+		return nil
+	}
+	err := h.file.Close()
+	h.file = nil
+	return err
+}
+
+func (h *History) snapshot() []*task_dagflow.RunReport {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	return h.runs.ToSlice()
+}
+
+func (h *History) matchRun(query Query, report *task_dagflow.RunReport) bool {
+	if !Helper.MatchRun(query, report) {
+		return false
+	}
+	if !Helper.hasTaskConditions(query) {
+		return true
+	}
+	for i := range report.Tasks {
+		if Helper.MatchTask(query, &report.Tasks[i]) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,159 @@
+package dagflowhistory
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Steve-Lee-CST/go-pico-tool/pkg/task_dagflow"
+	"github.com/Steve-Lee-CST/go-pico-tool/pkg/task_dagflow/dagflowtest"
+)
+
+type (
+	Profile string
+	Page    string
+)
+
+type pageCollection struct {
+	userID string
+}
+
+func (c *pageCollection) InputTypes() []reflect.Type {
+	return []reflect.Type{nil}
+}
+
+func (c *pageCollection) TargetTypes() []reflect.Type {
+	return []reflect.Type{reflect.TypeOf(Page(""))}
+}
+
+func (c *pageCollection) Summary() string {
+	return "user=" + c.userID
+}
+
+// runPages runs the page flow once per user, the profile task of "slow" times out
+func runPages(t *testing.T, history *History, users ...string) {
+	t.Helper()
+	profile := dagflowtest.NewStubTask[*pageCollection]("ProfileTask", reflect.TypeOf(Profile(""))).
+		WithTimeout(20 * time.Millisecond).
+		WithRun(func(ctx context.Context, c *pageCollection) error {
+			if c.userID == "slow" {
+				<-ctx.Done()
+			}
+			return nil
+		})
+	page := dagflowtest.NewStubTask[*pageCollection]("PageTask", reflect.TypeOf(Page("")), reflect.TypeOf(Profile("")))
+
+	factory := task_dagflow.NewFactoryWithConfig[*pageCollection](task_dagflow.Config{Name: "page"})
+	factory.AddRunObserver(history.Observe)
+	for _, task := range []*dagflowtest.StubTask[*pageCollection]{profile, page} {
+		if err := factory.RegisterTask(task.CreateFunc()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := factory.CreateGraph(); err != nil {
+		t.Fatal(err)
+	}
+	for _, user := range users {
+		flow, err := factory.CreateTaskDagflow(&pageCollection{userID: user})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = flow.Execute(context.Background(), time.Second)
+	}
+}
+
+func TestHistory_Query(t *testing.T) {
+	history, err := NewHistory(GetDefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	since := time.Now()
+	runPages(t, history, "ada", "slow", "linus", "slow")
+
+	if runs := history.Runs(Query{}); len(runs) != 4 || runs[0].Collection != "user=slow" || runs[1].Collection != "user=linus" {
+		t.Fatalf("unexpected runs %v", runs)
+	}
+	if runs := history.Runs(Query{Status: task_dagflow.RunStatusFailed}); len(runs) != 2 {
+		t.Errorf("expected 2 failed runs, got %d", len(runs))
+	}
+	if runs := history.Runs(Query{Task: "ProfileTask", TimedOut: true, Limit: 1}); len(runs) != 1 || runs[0].Collection != "user=slow" {
+		t.Errorf("unexpected timed out runs %v", runs)
+	}
+	if runs := history.Runs(Query{Since: time.Now()}); len(runs) != 0 {
+		t.Errorf("expected no run after now, got %d", len(runs))
+	}
+	if runs := history.Runs(Query{Since: since, FlowName: "other"}); len(runs) != 0 {
+		t.Errorf("expected no run of other flow, got %d", len(runs))
+	}
+
+	stats := history.TaskStats(Query{Since: since})
+	if len(stats) != 2 {
+		t.Fatalf("unexpected stats %v", stats)
+	}
+	if page := stats[0]; page.Task != "PageTask" || page.Succeeded != 2 || page.Skipped != 2 {
+		t.Errorf("unexpected page stat %+v", page)
+	}
+	profile := stats[1]
+	if profile.Task != "ProfileTask" || profile.Runs != 4 || profile.Failed != 2 || profile.TimedOut != 2 {
+		t.Errorf("unexpected profile stat %+v", profile)
+	}
+	if profile.MaxTimeCost < 20*time.Millisecond || profile.AvgTimeCost > profile.MaxTimeCost || profile.LastError == "" {
+		t.Errorf("unexpected profile time cost %+v", profile)
+	}
+}
+
+func TestHistory_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "runs.jsonl")
+	history, err := NewHistory(Config{Capacity: 3, FilePath: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	runPages(t, history, "ada", "slow", "linus", "grace")
+	if history.Size() != 3 {
+		t.Errorf("expected 3 runs in memory, got %d", history.Size())
+	}
+	if err := history.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a process killed while writing leaves a partial line
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = file.WriteString(`{"flow_name":"pa`)
+	_ = file.Close()
+
+	reopened, err := NewHistory(Config{Capacity: 10, FilePath: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	runs := reopened.Runs(Query{})
+	if len(runs) != 4 || runs[0].Collection != "user=grace" || runs[3].Collection != "user=ada" {
+		t.Fatalf("unexpected reloaded runs %v", runs)
+	}
+	if stats := reopened.TaskStats(Query{Task: "ProfileTask", TimedOut: true}); len(stats) != 1 || stats[0].TimedOut != 1 {
+		t.Errorf("unexpected reloaded stats %v", stats)
+	}
+	runPages(t, reopened, "alan")
+	if runs := reopened.Runs(Query{}); len(runs) != 5 || runs[0].Collection != "user=alan" {
+		t.Errorf("unexpected runs after reopening %v", runs)
+	}
+	if reopened.Err() != nil {
+		t.Errorf("unexpected error %v", reopened.Err())
+	}
+	if err := reopened.Close(); err != nil {
+		t.Fatal(err)
+	}
+	again, err := NewHistory(Config{Capacity: 10, FilePath: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer again.Close()
+	if again.Size() != 5 {
+		t.Errorf("expected 5 runs in file, got %d", again.Size())
+	}
+}
@@ -0,0 +1,20 @@
+package dagflowsched
+
+import "github.com/Steve-Lee-CST/go-pico-tool/pkg/task_dagflow/dagflowhistory"
+
+type Config struct {
+	// History receives the reports of scheduled flow runs, may be nil.
+	// Don't also pass History.Observe to AddRunObserver of the scheduled factories, runs would be recorded twice.
+	History *dagflowhistory.History
+	// OnRun is called after every scheduled run, may be nil
+	OnRun func(run JobRun)
+}
+
+var defaultConfig = Config{
+	History: nil,
+	OnRun:   nil,
+}
+
+func GetDefaultConfig() Config {
+	return defaultConfig
+}
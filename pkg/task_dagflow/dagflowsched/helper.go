@@ -0,0 +1,31 @@
+package dagflowsched
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+type helper struct{}
+
+var Helper = helper{}
+
+// Jitter returns a random duration in [0, max), 0 if max <= 0
+func (helper) Jitter(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int64N(int64(max)))
+}
+
+// NextTimes returns the next n times of the schedule after the given time, for checking cron expressions
+func (helper) NextTimes(schedule Schedule, after time.Time, n int) []time.Time {
+	times := make([]time.Time, 0, n)
+	for len(times) < n {
+		after = schedule.Next(after)
+		if after.IsZero() {
+			break
+		}
+		times = append(times, after)
+	}
+	return times
+}
@@ -0,0 +1,399 @@
+package dagflowsched
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Steve-Lee-CST/go-pico-tool/pkg/task_dagflow"
+)
+
+// OverlapPolicy decides what happens when a job is due while its previous run is still running
+type OverlapPolicy string
+
+const (
+	// OverlapSkip drops the due run
+	OverlapSkip OverlapPolicy = "skip"
+	// OverlapQueue starts the due run once the previous one finishes, at most Job.MaxQueued runs wait
+	OverlapQueue OverlapPolicy = "queue"
+	// OverlapCancel cancels the ctx of the previous run and starts the due run once it returns
+	OverlapCancel OverlapPolicy = "cancel"
+)
+
+type RunStatus string
+
+const (
+	RunStatusSuccess RunStatus = "success"
+	RunStatusFailed  RunStatus = "failed"
+	// RunStatusCanceled: the run was canceled by OverlapCancel, Remove or Stop
+	RunStatusCanceled RunStatus = "canceled"
+)
+
+var (
+	ErrJobExists   = errors.New("dagflowsched: job already exists")
+	ErrJobNotFound = errors.New("dagflowsched: job not found")
+	ErrNotStarted  = errors.New("dagflowsched: scheduler not started")
+)
+
+// RunFunc executes one run of a job, report is fed into Config.History if not nil.
+// ctx is canceled when the run is canceled, see RunStatusCanceled.
+type RunFunc func(ctx context.Context) (report *task_dagflow.RunReport, err error)
+
+type Job struct {
+	// Name identifies the job in the scheduler
+	Name     string
+	Schedule Schedule
+	// Overlap is OverlapSkip if empty
+	Overlap OverlapPolicy
+	// MaxQueued is the number of runs waiting with OverlapQueue, further due runs are skipped, 1 if <= 0
+	MaxQueued int
+	// Jitter delays every scheduled run by a random duration in [0, Jitter), to spread jobs due at the same time
+	Jitter time.Duration
+	Run    RunFunc
+}
+
+// JobRun describes a finished run of a job
+type JobRun struct {
+	Job string `json:"job"`
+	// ScheduledTime is the time the run was due, without jitter
+	ScheduledTime time.Time     `json:"scheduled_time"`
+	StartTime     time.Time     `json:"start_time"`
+	TimeCost      time.Duration `json:"time_cost"`
+	Status        RunStatus     `json:"status"`
+	Error         string        `json:"error,omitempty"`
+	// RunID is the run id of the flow report, empty if the run returned no report
+	RunID string `json:"run_id,omitempty"`
+}
+
+type JobStats struct {
+	Name    string        `json:"name"`
+	Overlap OverlapPolicy `json:"overlap"`
+	// NextTime is the next due time with jitter, zero if the scheduler is stopped or the schedule is over
+	NextTime time.Time `json:"next_time"`
+	Running  bool      `json:"running"`
+	Queued   int       `json:"queued"`
+	Runs     int       `json:"runs"`
+	Failed   int       `json:"failed"`
+	Canceled int       `json:"canceled"`
+	// Skipped counts due runs dropped by the overlap policy
+	Skipped int     `json:"skipped"`
+	LastRun *JobRun `json:"last_run,omitempty"`
+}
+
+// FlowRun returns a RunFunc executing a flow of the factory with the timeout,
+// on a collection built by newCollection for every run
+func FlowRun[CT task_dagflow.ICollection](
+	factory *task_dagflow.Factory[CT], newCollection func(ctx context.Context) (CT, error), timeout time.Duration,
+) RunFunc {
+	return func(ctx context.Context) (*task_dagflow.RunReport, error) {
+		collection, err := newCollection(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("create collection: %w", err)
+		}
+		flow, err := factory.CreateTaskDagflow(collection)
+		if err != nil {
+			return nil, err
+		}
+		err = flow.Execute(ctx, timeout)
+		return flow.Report(), err
+	}
+}
+
+// Scheduler runs jobs on their schedules, every job has its own goroutine and runs concurrently with other jobs
+type Scheduler struct {
+	config Config
+	lock   sync.Mutex
+	jobs   map[string]*jobState
+	// ctx is nil when the scheduler is not started
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+type jobState struct {
+	job Job
+	// stop ends the loop of the job and cancels its run
+	stop    context.CancelFunc
+	trigger chan struct{}
+
+	lock      sync.Mutex
+	nextTime  time.Time
+	running   bool
+	queued    []time.Time
+	cancelRun context.CancelFunc
+	// canceling is set when the running run is canceled by OverlapCancel
+	canceling bool
+	stats     JobStats
+}
+
+func NewScheduler(config Config) *Scheduler {
+	return &Scheduler{config: config, jobs: make(map[string]*jobState)}
+}
+
+// Add registers the job, it is scheduled at once if the scheduler is started
+func (s *Scheduler) Add(job Job) error {
+	switch {
+	case job.Name == "":
+		return errors.New("dagflowsched: job name is empty")
+	case job.Schedule == nil:
+		return fmt.Errorf("dagflowsched: job %s has no schedule", job.Name)
+	case job.Run == nil:
+		return fmt.Errorf("dagflowsched: job %s has no run func", job.Name)
+	}
+	switch job.Overlap {
+	case "":
+		job.Overlap = OverlapSkip
+	case OverlapSkip, OverlapQueue, OverlapCancel:
+	default:
+		return fmt.Errorf("dagflowsched: job %s has invalid overlap policy %q", job.Name, job.Overlap)
+	}
+	if job.MaxQueued <= 0 {
+		job.MaxQueued = 1
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.jobs[job.Name]; ok {
+		return fmt.Errorf("%w: %s", ErrJobExists, job.Name)
+	}
+	state := &jobState{
+		job:     job,
+		trigger: make(chan struct{}, 1),
+		stats:   JobStats{Name: job.Name, Overlap: job.Overlap},
+	}
+	s.jobs[job.Name] = state
+	if s.ctx != nil {
+		s.startJob(state)
+	}
+	return nil
+}
+
+// Remove unschedules the job and cancels its running run without waiting for it
+func (s *Scheduler) Remove(name string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	state, ok := s.jobs[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrJobNotFound, name)
+	}
+	delete(s.jobs, name)
+	if state.stop != nil {
+		state.stop()
+	}
+	return nil
+}
+
+// Trigger makes the job due now, the overlap policy applies and the schedule is unchanged
+func (s *Scheduler) Trigger(name string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	state, ok := s.jobs[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrJobNotFound, name)
+	}
+	if s.ctx == nil {
+		return ErrNotStarted
+	}
+	select {
+	case state.trigger <- struct{}{}:
+	default:
+		// a trigger is pending already
+	}
+	return nil
+}
+
+// Start schedules all jobs, it does nothing if the scheduler is started
+func (s *Scheduler) Start() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.ctx != nil {
+		return
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	for _, state := range s.jobs {
+		s.startJob(state)
+	}
+}
+
+// Stop unschedules all jobs, cancels running runs and waits for them to return.
+// Jobs are kept and the scheduler can be started again.
+func (s *Scheduler) Stop() {
+	s.lock.Lock()
+	if s.ctx == nil {
+		s.lock.Unlock()
+		return
+	}
+	s.cancel()
+	s.ctx, s.cancel = nil, nil
+	s.lock.Unlock()
+	s.wg.Wait()
+}
+
+// Stats returns the stats of every job, sorted by name
+func (s *Scheduler) Stats() []JobStats {
+	s.lock.Lock()
+	states := make([]*jobState, 0, len(s.jobs))
+	for _, state := range s.jobs {
+		states = append(states, state)
+	}
+	s.lock.Unlock()
+
+	stats := make([]JobStats, 0, len(states))
+	for _, state := range states {
+		stats = append(stats, state.getStats())
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Name < stats[j].Name
+	})
+	return stats
+}
+
+// startJob must be called with the lock held
+func (s *Scheduler) startJob(state *jobState) {
+	ctx, stop := context.WithCancel(s.ctx)
+	state.stop = stop
+	s.wg.Add(1)
+	go s.loop(ctx, state)
+}
+
+func (s *Scheduler) loop(ctx context.Context, state *jobState) {
+	defer s.wg.Done()
+	defer state.setNextTime(time.Time{})
+
+	next := state.job.Schedule.Next(time.Now())
+	for !next.IsZero() {
+		fireTime := next.Add(Helper.Jitter(state.job.Jitter))
+		state.setNextTime(fireTime)
+		timer := time.NewTimer(time.Until(fireTime))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-state.trigger:
+			timer.Stop()
+			s.fire(ctx, state, time.Now())
+			continue
+		case <-timer.C:
+			s.fire(ctx, state, next)
+		}
+		// don't catch up on times missed while the process was suspended
+		if next = state.job.Schedule.Next(next); !next.IsZero() && next.Before(time.Now()) {
+			next = state.job.Schedule.Next(time.Now())
+		}
+	}
+}
+
+// fire starts a run of the job due at scheduled, or applies the overlap policy
+func (s *Scheduler) fire(ctx context.Context, state *jobState, scheduled time.Time) {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	if !state.running {
+		state.running = true
+		runCtx := state.newRun(ctx)
+		s.wg.Add(1)
+		go s.runLoop(ctx, state, runCtx, scheduled)
+		return
+	}
+	switch state.job.Overlap {
+	case OverlapQueue:
+		if len(state.queued) < state.job.MaxQueued {
+			state.queued = append(state.queued, scheduled)
+		} else {
+			state.stats.Skipped++
+		}
+	case OverlapCancel:
+		state.stats.Skipped += len(state.queued)
+		state.queued = []time.Time{scheduled}
+		state.canceling = true
+		state.cancelRun()
+	default:
+		state.stats.Skipped++
+	}
+}
+
+// runLoop runs the job, then its queued runs until the queue is empty
+func (s *Scheduler) runLoop(ctx context.Context, state *jobState, runCtx context.Context, scheduled time.Time) {
+	defer s.wg.Done()
+	for {
+		run, report := s.runOnce(runCtx, state.job, scheduled)
+
+		state.lock.Lock()
+		state.cancelRun()
+		if run.Status == RunStatusFailed && (state.canceling || ctx.Err() != nil) {
+			run.Status = RunStatusCanceled
+		}
+		state.record(run)
+		more := len(state.queued) > 0 && ctx.Err() == nil
+		if more {
+			scheduled, state.queued = state.queued[0], state.queued[1:]
+			runCtx = state.newRun(ctx)
+		} else {
+			state.running, state.queued, state.cancelRun = false, nil, nil
+		}
+		state.lock.Unlock()
+
+		if report != nil && s.config.History != nil {
+			s.config.History.Observe(report)
+		}
+		if s.config.OnRun != nil {
+			s.config.OnRun(run)
+		}
+		if !more {
+			return
+		}
+	}
+}
+
+func (s *Scheduler) runOnce(ctx context.Context, job Job, scheduled time.Time) (JobRun, *task_dagflow.RunReport) {
+	run := JobRun{Job: job.Name, ScheduledTime: scheduled, StartTime: time.Now(), Status: RunStatusSuccess}
+	report, err := job.Run(ctx)
+	run.TimeCost = time.Since(run.StartTime)
+	if err != nil {
+		run.Status, run.Error = RunStatusFailed, err.Error()
+	}
+	if report != nil {
+		run.RunID = report.RunID
+	}
+	return run, report
+}
+
+// newRun creates the ctx of the next run, so OverlapCancel can cancel it as soon as it is due.
+// It must be called with the lock held.
+func (j *jobState) newRun(ctx context.Context) context.Context {
+	runCtx, cancel := context.WithCancel(ctx)
+	j.cancelRun, j.canceling = cancel, false
+	return runCtx
+}
+
+func (j *jobState) setNextTime(next time.Time) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	j.nextTime = next
+}
+
+// record must be called with the lock held
+func (j *jobState) record(run JobRun) {
+	j.stats.Runs++
+	switch run.Status {
+	case RunStatusFailed:
+		j.stats.Failed++
+	case RunStatusCanceled:
+		j.stats.Canceled++
+	}
+	j.stats.LastRun = &run
+}
+
+func (j *jobState) getStats() JobStats {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	stats := j.stats
+	stats.NextTime, stats.Running, stats.Queued = j.nextTime, j.running, len(j.queued)
+	if stats.LastRun != nil {
+		lastRun := *stats.LastRun
+		stats.LastRun = &lastRun
+	}
+	return stats
+}
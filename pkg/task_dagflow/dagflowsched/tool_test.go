@@ -0,0 +1,281 @@
+package dagflowsched
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Steve-Lee-CST/go-pico-tool/pkg/task_dagflow"
+	"github.com/Steve-Lee-CST/go-pico-tool/pkg/task_dagflow/dagflowhistory"
+	"github.com/Steve-Lee-CST/go-pico-tool/pkg/task_dagflow/dagflowtest"
+)
+
+type Report string
+
+type reportCollection struct{}
+
+func (c *reportCollection) InputTypes() []reflect.Type {
+	return []reflect.Type{nil}
+}
+
+func (c *reportCollection) TargetTypes() []reflect.Type {
+	return []reflect.Type{reflect.TypeOf(Report(""))}
+}
+
+// waitFor polls cond until it holds or the second is over
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// blockingJob returns a job whose runs block until released or canceled
+func blockingJob(name string, overlap OverlapPolicy, started chan<- int, release <-chan struct{}) Job {
+	var runs atomic.Int32
+	return Job{
+		Name:     name,
+		Schedule: Every(time.Hour),
+		Overlap:  overlap,
+		Run: func(ctx context.Context) (*task_dagflow.RunReport, error) {
+			started <- int(runs.Add(1))
+			select {
+			case <-release:
+				return nil, nil
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		},
+	}
+}
+
+func TestParseCron(t *testing.T) {
+	base := time.Date(2026, time.March, 30, 10, 7, 30, 0, time.UTC) // monday
+	tests := []struct {
+		expr string
+		want []time.Time
+	}{
+		{"*/15 * * * *", []time.Time{
+			time.Date(2026, time.March, 30, 10, 15, 0, 0, time.UTC),
+			time.Date(2026, time.March, 30, 10, 30, 0, 0, time.UTC),
+			time.Date(2026, time.March, 30, 10, 45, 0, 0, time.UTC),
+		}},
+		{"0 9-17/4 * * mon-fri", []time.Time{
+			time.Date(2026, time.March, 30, 13, 0, 0, 0, time.UTC),
+			time.Date(2026, time.March, 30, 17, 0, 0, 0, time.UTC),
+			time.Date(2026, time.March, 31, 9, 0, 0, 0, time.UTC),
+		}},
+		{"30 2 1 * 7", []time.Time{
+			time.Date(2026, time.April, 1, 2, 30, 0, 0, time.UTC),
+			time.Date(2026, time.April, 5, 2, 30, 0, 0, time.UTC),
+			time.Date(2026, time.April, 12, 2, 30, 0, 0, time.UTC),
+		}},
+		{"0 0 29 feb *", []time.Time{
+			time.Date(2028, time.February, 29, 0, 0, 0, 0, time.UTC),
+		}},
+		{"@daily", []time.Time{
+			time.Date(2026, time.March, 31, 0, 0, 0, 0, time.UTC),
+			time.Date(2026, time.April, 1, 0, 0, 0, 0, time.UTC),
+		}},
+		{"@every 90m", []time.Time{
+			base.Add(90 * time.Minute),
+			base.Add(180 * time.Minute),
+		}},
+	}
+	for _, tt := range tests {
+		schedule, err := ParseCron(tt.expr, time.UTC)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.expr, err)
+		}
+		if got := Helper.NextTimes(schedule, base, len(tt.want)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.expr, tt.want, got)
+		}
+	}
+
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* * 0 * *", "5-1 * * * *", "*/0 * * * *", "* * * foo *", "@every -1s"} {
+		if _, err := ParseCron(expr, time.UTC); err == nil {
+			t.Errorf("%q: expected an error", expr)
+		}
+	}
+	if schedule, _ := ParseCron("0 0 31 feb *", time.UTC); !schedule.Next(base).IsZero() {
+		t.Error("expected no next time for february 31")
+	}
+}
+
+func TestScheduler_Interval(t *testing.T) {
+	var runs atomic.Int32
+	scheduler := NewScheduler(GetDefaultConfig())
+	err := scheduler.Add(Job{
+		Name:     "tick",
+		Schedule: Every(10 * time.Millisecond),
+		Jitter:   5 * time.Millisecond,
+		Run: func(ctx context.Context) (*task_dagflow.RunReport, error) {
+			runs.Add(1)
+			return nil, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := scheduler.Add(Job{Name: "tick", Schedule: Every(time.Second), Run: func(context.Context) (*task_dagflow.RunReport, error) {
+		return nil, nil
+	}}); !errors.Is(err, ErrJobExists) {
+		t.Errorf("expected ErrJobExists, got %v", err)
+	}
+	if err := scheduler.Trigger("tick"); !errors.Is(err, ErrNotStarted) {
+		t.Errorf("expected ErrNotStarted, got %v", err)
+	}
+
+	scheduler.Start()
+	waitFor(t, func() bool { return runs.Load() >= 3 })
+	scheduler.Stop()
+
+	stats := scheduler.Stats()
+	if len(stats) != 1 || stats[0].Runs < 3 || stats[0].Failed != 0 || !stats[0].NextTime.IsZero() || stats[0].LastRun == nil {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	stopped := runs.Load()
+	time.Sleep(30 * time.Millisecond)
+	if runs.Load() != stopped {
+		t.Error("expected no runs after Stop")
+	}
+}
+
+func TestScheduler_Overlap(t *testing.T) {
+	tests := []struct {
+		overlap OverlapPolicy
+		// runs and counters once the first run is released
+		runs, canceled, skipped int
+	}{
+		{OverlapSkip, 1, 0, 2},
+		{OverlapQueue, 2, 0, 1},
+		{OverlapCancel, 3, 2, 0},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.overlap), func(t *testing.T) {
+			started, release := make(chan int, 4), make(chan struct{})
+			scheduler := NewScheduler(GetDefaultConfig())
+			if err := scheduler.Add(blockingJob("job", tt.overlap, started, release)); err != nil {
+				t.Fatal(err)
+			}
+			scheduler.Start()
+			defer scheduler.Stop()
+
+			if err := scheduler.Trigger("job"); err != nil {
+				t.Fatal(err)
+			}
+			<-started
+			// two more due runs while the first one is running
+			for i := 1; i <= 2; i++ {
+				if err := scheduler.Trigger("job"); err != nil {
+					t.Fatal(err)
+				}
+				if tt.overlap == OverlapCancel {
+					// the canceled run is replaced
+					<-started
+					continue
+				}
+				waitFor(t, func() bool {
+					stats := scheduler.Stats()[0]
+					return stats.Skipped+stats.Queued == i
+				})
+			}
+			close(release)
+			waitFor(t, func() bool {
+				stats := scheduler.Stats()[0]
+				return !stats.Running && stats.Runs == tt.runs
+			})
+
+			stats := scheduler.Stats()[0]
+			if stats.Canceled != tt.canceled || stats.Skipped != tt.skipped || stats.Failed != 0 {
+				t.Errorf("unexpected stats %+v", stats)
+			}
+		})
+	}
+}
+
+// TestScheduler_CancelBeforeRunStarts fires a job twice before its first run goroutine starts:
+// OverlapCancel must cancel the first run instead of calling a nil cancel func
+func TestScheduler_CancelBeforeRunStarts(t *testing.T) {
+	started, release := make(chan int, 4), make(chan struct{})
+	scheduler := NewScheduler(GetDefaultConfig())
+	if err := scheduler.Add(blockingJob("job", OverlapCancel, started, release)); err != nil {
+		t.Fatal(err)
+	}
+	state := scheduler.jobs["job"]
+	scheduler.fire(context.Background(), state, time.Now())
+	scheduler.fire(context.Background(), state, time.Now())
+
+	<-started
+	<-started
+	close(release)
+	scheduler.wg.Wait()
+	if stats := state.getStats(); stats.Runs != 2 || stats.Canceled != 1 || stats.Running {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestScheduler_FlowRunHistory(t *testing.T) {
+	report := dagflowtest.NewStubTask[*reportCollection]("ReportTask", reflect.TypeOf(Report("")))
+	factory := task_dagflow.NewFactoryWithConfig[*reportCollection](task_dagflow.Config{Name: "daily-report"})
+	if err := factory.RegisterTask(report.CreateFunc()); err != nil {
+		t.Fatal(err)
+	}
+	if err := factory.CreateGraph(); err != nil {
+		t.Fatal(err)
+	}
+	history, err := dagflowhistory.NewHistory(dagflowhistory.GetDefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := GetDefaultConfig()
+	config.History = history
+	runs := make(chan JobRun, 2)
+	config.OnRun = func(run JobRun) { runs <- run }
+	scheduler := NewScheduler(config)
+	scheduler.Start()
+	defer scheduler.Stop()
+
+	newCollection := func(ctx context.Context) (*reportCollection, error) { return &reportCollection{}, nil }
+	failing := func(ctx context.Context) (*reportCollection, error) { return nil, errors.New("no source") }
+	for name, run := range map[string]RunFunc{
+		"report":  FlowRun(factory, newCollection, time.Second),
+		"failing": FlowRun(factory, failing, time.Second),
+	} {
+		if err := scheduler.Add(Job{Name: name, Schedule: Every(time.Hour), Run: run}); err != nil {
+			t.Fatal(err)
+		}
+		if err := scheduler.Trigger(name); err != nil {
+			t.Fatal(err)
+		}
+		switch run := <-runs; name {
+		case "report":
+			if run.Status != RunStatusSuccess || run.RunID == "" {
+				t.Errorf("unexpected run %+v", run)
+			}
+		case "failing":
+			if run.Status != RunStatusFailed || run.Error != "create collection: no source" || run.RunID != "" {
+				t.Errorf("unexpected run %+v", run)
+			}
+		}
+	}
+
+	reports := history.Runs(dagflowhistory.Query{FlowName: "daily-report"})
+	if len(reports) != 1 || reports[0].Status != task_dagflow.RunStatusSuccess {
+		t.Errorf("unexpected history %v", reports)
+	}
+	if err := scheduler.Remove("report"); err != nil {
+		t.Fatal(err)
+	}
+	if err := scheduler.Trigger("report"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("expected ErrJobNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,41 @@
+package dagflowslog
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+type Config struct {
+	// Logger receives the records, slog.Default() if nil
+	Logger *slog.Logger
+	// LogFlowStart enables the record of flow start, flow finish is always recorded
+	LogFlowStart bool
+	// FlowLevel is the level of flow start and successful flow finish records
+	FlowLevel slog.Level
+	// TaskLevel is the level of successful tasks: set it below the level of the handler
+	// to only log slow or failed tasks
+	TaskLevel slog.Level
+	// SlowTaskThreshold: successful tasks taking longer are logged at SlowLevel, disabled if <= 0
+	SlowTaskThreshold time.Duration
+	SlowLevel         slog.Level
+	// ErrorLevel is the level of failed flows and tasks
+	ErrorLevel slog.Level
+	// ContextAttrs returns extra attributes from the ctx of a run or a task, e.g. a trace id, may be nil
+	ContextAttrs func(ctx context.Context) []slog.Attr
+}
+
+var defaultConfig = Config{
+	Logger:            nil,
+	LogFlowStart:      true,
+	FlowLevel:         slog.LevelInfo,
+	TaskLevel:         slog.LevelDebug,
+	SlowTaskThreshold: time.Second,
+	SlowLevel:         slog.LevelWarn,
+	ErrorLevel:        slog.LevelError,
+	ContextAttrs:      nil,
+}
+
+func GetDefaultConfig() Config {
+	return defaultConfig
+}
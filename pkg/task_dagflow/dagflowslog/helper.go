@@ -0,0 +1,55 @@
+package dagflowslog
+
+import (
+	"log/slog"
+
+	"github.com/Steve-Lee-CST/go-pico-tool/pkg/task_dagflow"
+)
+
+// Attribute keys of the records
+const (
+	KeyFlow         = "flow"
+	KeyGraphVersion = "graph_version"
+	KeyRunID        = "run_id"
+	KeyRequestID    = "request_id"
+	KeyTask         = "task"
+	KeyAttempt      = "attempt"
+	KeyOutputType   = "output_type"
+	KeyStatus       = "status"
+	KeyDuration     = "duration"
+	KeyError        = "error"
+	KeyTimedOut     = "timed_out"
+	KeyPanic        = "panic"
+	KeyTasks        = "tasks"
+	KeyFailedTasks  = "failed_tasks"
+)
+
+type helper struct{}
+
+var Helper = helper{}
+
+// RunAttrs identify a run, the request id is left out when empty
+func (h helper) RunAttrs(flowName string, runID string, requestID string) []slog.Attr {
+	attrs := []slog.Attr{slog.String(KeyFlow, flowName), slog.String(KeyRunID, runID)}
+	if requestID != "" {
+		attrs = append(attrs, slog.String(KeyRequestID, requestID))
+	}
+	return attrs
+}
+
+// TaskAttrs identify a task of a run
+func (h helper) TaskAttrs(metadata task_dagflow.TaskMetadata) []slog.Attr {
+	return append(h.RunAttrs(metadata.FlowName, metadata.RunID, metadata.RequestID),
+		slog.String(KeyTask, metadata.TaskName),
+		slog.Int(KeyAttempt, metadata.Attempt),
+	)
+}
+
+// FailedTasks returns names of failed tasks in the report, nil if none
+func (h helper) FailedTasks(report *task_dagflow.RunReport) []string {
+	var names []string
+	for _, task := range report.FailedTasks() {
+		names = append(names, task.Name)
+	}
+	return names
+}
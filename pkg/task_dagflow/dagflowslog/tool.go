@@ -0,0 +1,147 @@
+package dagflowslog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/Steve-Lee-CST/go-pico-tool/pkg/task_dagflow"
+)
+
+// Logger writes structured records of flow runs and tasks to an slog.Logger
+type Logger struct {
+	config Config
+	logger *slog.Logger
+	// runAttrs are the context attributes of running flows by run id, from start to finish
+	runAttrs sync.Map
+}
+
+func NewLogger(config Config) *Logger {
+	logger := config.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Logger{config: config, logger: logger}
+}
+
+// Register logs runs and tasks of the factory, call it before CreateGraph since interceptors
+// take effect from the next snapshot
+func Register[CT task_dagflow.ICollection](l *Logger, factory *task_dagflow.Factory[CT]) {
+	factory.Use(Interceptor[CT](l))
+	factory.AddRunStartObserver(l.RunStarted)
+	factory.AddRunObserver(l.RunFinished)
+}
+
+// RunStarted is a task_dagflow.RunStartObserver, it keeps the context attributes of the run for RunFinished
+func (l *Logger) RunStarted(ctx context.Context, start task_dagflow.RunStart) {
+	if l.config.ContextAttrs != nil {
+		if attrs := l.config.ContextAttrs(ctx); len(attrs) > 0 {
+			l.runAttrs.Store(start.RunID, attrs)
+		}
+	}
+	if !l.config.LogFlowStart || !l.logger.Enabled(ctx, l.config.FlowLevel) {
+		return
+	}
+	attrs := append(Helper.RunAttrs(start.FlowName, start.RunID, start.RequestID),
+		slog.Uint64(KeyGraphVersion, start.GraphVersion),
+		slog.Int(KeyTasks, start.TaskCount),
+	)
+	attrs = append(attrs, l.contextAttrs(start.RunID)...)
+	l.logger.LogAttrs(ctx, l.config.FlowLevel, "dagflow run started", attrs...)
+}
+
+// RunFinished is a task_dagflow.RunObserver
+func (l *Logger) RunFinished(report *task_dagflow.RunReport) {
+	contextAttrs := l.contextAttrs(report.RunID)
+	l.runAttrs.Delete(report.RunID)
+
+	ctx, level := context.Background(), l.config.FlowLevel
+	if report.Status != task_dagflow.RunStatusSuccess {
+		level = l.config.ErrorLevel
+	}
+	if !l.logger.Enabled(ctx, level) {
+		return
+	}
+	attrs := append(Helper.RunAttrs(report.FlowName, report.RunID, report.RequestID),
+		slog.Uint64(KeyGraphVersion, report.GraphVersion),
+		slog.String(KeyStatus, string(report.Status)),
+		slog.Duration(KeyDuration, report.TimeCost),
+		slog.Int(KeyTasks, len(report.Tasks)),
+	)
+	if report.Error != "" {
+		attrs = append(attrs, slog.String(KeyError, report.Error))
+	}
+	if failed := Helper.FailedTasks(report); len(failed) > 0 {
+		attrs = append(attrs, slog.Any(KeyFailedTasks, failed))
+	}
+	attrs = append(attrs, contextAttrs...)
+	l.logger.LogAttrs(ctx, level, "dagflow run finished", attrs...)
+}
+
+func (l *Logger) contextAttrs(runID string) []slog.Attr {
+	attrs, _ := l.runAttrs.Load(runID)
+	contextAttrs, _ := attrs.([]slog.Attr)
+	return contextAttrs
+}
+
+// Interceptor logs the outcome and duration of every attempt of a task: a failed attempt at ErrorLevel,
+// a slow one at SlowLevel and others at TaskLevel
+func Interceptor[CT task_dagflow.ICollection](l *Logger) task_dagflow.Interceptor[CT] {
+	return func(
+		ctx context.Context, info task_dagflow.TaskInfo, collection CT, next task_dagflow.TaskHandler[CT],
+	) (err error) {
+		startTime := time.Now()
+		defer func() {
+			if r := recover(); r != nil {
+				l.logTask(ctx, info, time.Since(startTime), fmt.Errorf("%w: %v", task_dagflow.ErrTaskPanic, r), r)
+				panic(r)
+			}
+		}()
+		err = next(ctx, collection)
+		l.logTask(ctx, info, time.Since(startTime), err, nil)
+		return err
+	}
+}
+
+func (l *Logger) logTask(ctx context.Context, info task_dagflow.TaskInfo, duration time.Duration, err error, panicValue any) {
+	level := l.config.TaskLevel
+	switch {
+	case err != nil:
+		level = l.config.ErrorLevel
+	case l.config.SlowTaskThreshold > 0 && duration > l.config.SlowTaskThreshold:
+		level = l.config.SlowLevel
+	}
+	if !l.logger.Enabled(ctx, level) {
+		return
+	}
+
+	metadata, ok := task_dagflow.TaskMetadataFromContext(ctx)
+	if !ok {
+		metadata = task_dagflow.TaskMetadata{FlowName: info.FlowName, TaskName: info.Name}
+	}
+	attrs := append(Helper.TaskAttrs(metadata),
+		slog.String(KeyOutputType, info.OutputType.String()),
+		slog.Duration(KeyDuration, duration),
+	)
+	if err != nil {
+		attrs = append(attrs,
+			slog.String(KeyStatus, string(task_dagflow.TaskStatusFailed)),
+			slog.String(KeyError, err.Error()),
+		)
+		if errors.Is(err, context.DeadlineExceeded) {
+			attrs = append(attrs, slog.Bool(KeyTimedOut, true))
+		}
+		if panicValue != nil {
+			attrs = append(attrs, slog.Any(KeyPanic, panicValue))
+		}
+	} else {
+		attrs = append(attrs, slog.String(KeyStatus, string(task_dagflow.TaskStatusSuccess)))
+	}
+	if l.config.ContextAttrs != nil {
+		attrs = append(attrs, l.config.ContextAttrs(ctx)...)
+	}
+	l.logger.LogAttrs(ctx, level, "dagflow task finished", attrs...)
+}
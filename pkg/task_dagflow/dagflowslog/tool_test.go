@@ -0,0 +1,141 @@
+package dagflowslog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Steve-Lee-CST/go-pico-tool/pkg/task_dagflow"
+	"github.com/Steve-Lee-CST/go-pico-tool/pkg/task_dagflow/dagflowtest"
+)
+
+type (
+	Profile string
+	Orders  string
+	Page    string
+)
+
+type pageCollection struct{}
+
+func (c *pageCollection) InputTypes() []reflect.Type {
+	return []reflect.Type{nil}
+}
+
+func (c *pageCollection) TargetTypes() []reflect.Type {
+	return []reflect.Type{reflect.TypeOf(Page(""))}
+}
+
+type traceKey struct{}
+
+// syncBuffer collects json records written by tasks running in parallel
+type syncBuffer struct {
+	lock sync.Mutex
+	buf  bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) Records(t *testing.T) []map[string]any {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	records := make([]map[string]any, 0)
+	for _, line := range bytes.Split(bytes.TrimSpace(b.buf.Bytes()), []byte("\n")) {
+		record := map[string]any{}
+		if err := json.Unmarshal(line, &record); err != nil {
+			t.Fatalf("invalid record %s: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func runPage(t *testing.T, config Config, ordersErr error) []map[string]any {
+	t.Helper()
+	out := &syncBuffer{}
+	config.Logger = slog.New(slog.NewJSONHandler(out, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	config.SlowTaskThreshold = 30 * time.Millisecond
+	config.ContextAttrs = func(ctx context.Context) []slog.Attr {
+		if trace, ok := ctx.Value(traceKey{}).(string); ok {
+			return []slog.Attr{slog.String("trace", trace)}
+		}
+		return nil
+	}
+
+	factory := task_dagflow.NewFactoryWithConfig[*pageCollection](task_dagflow.Config{Name: "page"})
+	Register(NewLogger(config), factory)
+	for _, task := range []*dagflowtest.StubTask[*pageCollection]{
+		dagflowtest.NewStubTask[*pageCollection]("ProfileTask", reflect.TypeOf(Profile(""))),
+		dagflowtest.NewStubTask[*pageCollection]("OrdersTask", reflect.TypeOf(Orders(""))).
+			WithDelay(50 * time.Millisecond).WithError(ordersErr),
+		dagflowtest.NewStubTask[*pageCollection]("PageTask", reflect.TypeOf(Page("")),
+			reflect.TypeOf(Profile("")), reflect.TypeOf(Orders(""))),
+	} {
+		if err := factory.RegisterTask(task.CreateFunc()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := factory.CreateGraph(); err != nil {
+		t.Fatal(err)
+	}
+	flow, err := factory.CreateTaskDagflow(&pageCollection{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := task_dagflow.WithRequestID(context.WithValue(context.Background(), traceKey{}, "trace-1"), "req-1")
+	_ = flow.Execute(ctx, time.Second)
+	return out.Records(t)
+}
+
+func TestLogger_SlowTask(t *testing.T) {
+	records := runPage(t, GetDefaultConfig(), nil)
+	// fast tasks are logged at debug, below the handler level
+	if len(records) != 3 {
+		t.Fatalf("expected flow start, slow task and flow finish, got %v", records)
+	}
+	start, task, finish := records[0], records[1], records[2]
+	if start["msg"] != "dagflow run started" || start["level"] != "INFO" || start[KeyTasks] != 3.0 {
+		t.Errorf("unexpected start record %v", start)
+	}
+	if task["msg"] != "dagflow task finished" || task["level"] != "WARN" || task[KeyTask] != "OrdersTask" ||
+		task[KeyAttempt] != 1.0 || task[KeyStatus] != "success" || task[KeyOutputType] != "dagflowslog.Orders" {
+		t.Errorf("unexpected task record %v", task)
+	}
+	if finish["msg"] != "dagflow run finished" || finish["level"] != "INFO" || finish[KeyStatus] != "success" {
+		t.Errorf("unexpected finish record %v", finish)
+	}
+	for _, record := range records {
+		if record[KeyFlow] != "page" || record[KeyRunID] != start[KeyRunID] || record[KeyRunID] == "" ||
+			record[KeyRequestID] != "req-1" || record["trace"] != "trace-1" {
+			t.Errorf("record without run attributes %v", record)
+		}
+	}
+}
+
+func TestLogger_FailedTask(t *testing.T) {
+	config := GetDefaultConfig()
+	config.LogFlowStart = false
+	records := runPage(t, config, errors.New("orders unavailable"))
+	if len(records) != 2 {
+		t.Fatalf("expected failed task and flow finish, got %v", records)
+	}
+	task, finish := records[0], records[1]
+	if task["level"] != "ERROR" || task[KeyTask] != "OrdersTask" || task[KeyStatus] != "failed" ||
+		task[KeyError] != "orders unavailable" {
+		t.Errorf("unexpected task record %v", task)
+	}
+	failed, _ := finish[KeyFailedTasks].([]any)
+	if finish["level"] != "ERROR" || finish[KeyStatus] != "failed" || len(failed) != 1 || failed[0] != "OrdersTask" ||
+		finish["trace"] != "trace-1" {
+		t.Errorf("unexpected finish record %v", finish)
+	}
+}
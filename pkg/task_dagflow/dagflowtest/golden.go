@@ -0,0 +1,65 @@
+package dagflowtest
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/Steve-Lee-CST/go-pico-tool/pkg/task_dagflow"
+)
+
+var updateGolden = flag.Bool("dagflowtest.update", false, "update golden run reports")
+
+// NormalizeReport returns a copy of report without run id, times and durations,
+// and with tasks sorted by name, leaving what a run is expected to reproduce:
+// statuses, producers, errors and accesses
+func NormalizeReport(report *task_dagflow.RunReport) *task_dagflow.RunReport {
+	normalized := *report
+	normalized.RunID, normalized.StartTime, normalized.TimeCost = "", time.Time{}, 0
+	normalized.Tasks = make([]task_dagflow.TaskReport, 0, len(report.Tasks))
+	for _, task := range report.Tasks {
+		task.StartTime, task.TimeCost = time.Time{}, 0
+		normalized.Tasks = append(normalized.Tasks, task)
+	}
+	sort.Slice(normalized.Tasks, func(i, j int) bool {
+		return normalized.Tasks[i].Name < normalized.Tasks[j].Name
+	})
+	return &normalized
+}
+
+// AssertGoldenReport compares the normalized report with the json golden file at path.
+// Run tests with -dagflowtest.update to write the golden file.
+func AssertGoldenReport(t testing.TB, report *task_dagflow.RunReport, path string) bool {
+	t.Helper()
+	actual, err := json.MarshalIndent(NormalizeReport(report), "", "  ")
+	if err != nil {
+		t.Errorf("failed to marshal report: %v", err)
+		return false
+	}
+	actual = append(actual, '\n')
+
+	if *updateGolden {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Errorf("failed to create golden dir: %v", err)
+			return false
+		}
+		if err := os.WriteFile(path, actual, 0o644); err != nil {
+			t.Errorf("failed to update golden file: %v", err)
+			return false
+		}
+	}
+	expected, err := os.ReadFile(path)
+	if err != nil {
+		t.Errorf("failed to read golden file, run with -dagflowtest.update to create it: %v", err)
+		return false
+	}
+	if string(actual) != string(expected) {
+		t.Errorf("run report differs from %s\nexpected:\n%s\nactual:\n%s", path, expected, actual)
+		return false
+	}
+	return true
+}
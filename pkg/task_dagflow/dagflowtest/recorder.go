@@ -0,0 +1,207 @@
+package dagflowtest
+
+import (
+	"context"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Steve-Lee-CST/go-pico-tool/pkg/task_dagflow"
+)
+
+type EventKind string
+
+const (
+	EventStart  EventKind = "start"
+	EventFinish EventKind = "finish"
+)
+
+// Event is one task start or finish, Seq orders events without relying on clocks
+type Event struct {
+	Seq  int
+	Kind EventKind
+	Task string
+	Time time.Time
+	Err  error
+}
+
+// span is the first execution of a task in Seq numbers, finish is 0 while running
+type span struct {
+	start  int
+	finish int
+}
+
+// Recorder records task starts and finishes through an interceptor, its assertions
+// compare event order instead of durations, so they don't depend on machine speed.
+// Use one Recorder per run, a task executed twice is asserted by its first execution.
+type Recorder struct {
+	mu             sync.Mutex
+	events         []Event
+	running        int
+	maxConcurrency int
+}
+
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+// RecordInterceptor returns an interceptor recording into r, register it with Factory.Use
+// to record every task, or WithInterceptors to record some tasks only
+func RecordInterceptor[CT task_dagflow.ICollection](r *Recorder) task_dagflow.Interceptor[CT] {
+	return func(
+		ctx context.Context, info task_dagflow.TaskInfo, collection CT, next task_dagflow.TaskHandler[CT],
+	) error {
+		r.record(EventStart, info.Name, nil)
+		// a panicking task still finishes, with task_dagflow.ErrTaskPanic
+		err := task_dagflow.ErrTaskPanic
+		defer func() { r.record(EventFinish, info.Name, err) }()
+		err = next(ctx, collection)
+		return err
+	}
+}
+
+func (r *Recorder) record(kind EventKind, task string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if kind == EventStart {
+		r.running++
+		r.maxConcurrency = max(r.maxConcurrency, r.running)
+	} else {
+		r.running--
+	}
+	r.events = append(r.events, Event{Seq: len(r.events) + 1, Kind: kind, Task: task, Time: time.Now(), Err: err})
+}
+
+// Events returns a copy of recorded events in order
+func (r *Recorder) Events() []Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Event(nil), r.events...)
+}
+
+// StartOrder returns task names in the order they started
+func (r *Recorder) StartOrder() []string {
+	order := make([]string, 0)
+	for _, event := range r.Events() {
+		if event.Kind == EventStart {
+			order = append(order, event.Task)
+		}
+	}
+	return order
+}
+
+// MaxConcurrency returns the largest number of tasks running at the same time
+func (r *Recorder) MaxConcurrency() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.maxConcurrency
+}
+
+// Reset forgets recorded events
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events, r.running, r.maxConcurrency = nil, 0, 0
+}
+
+func (r *Recorder) span(task string) (span, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, found := span{}, false
+	for _, event := range r.events {
+		if event.Task != task {
+			continue
+		}
+		if event.Kind == EventStart && !found {
+			s.start, found = event.Seq, true
+		} else if event.Kind == EventFinish && found {
+			s.finish = event.Seq
+			break
+		}
+	}
+	return s, found
+}
+
+// AssertRan checks that all tasks started
+func (r *Recorder) AssertRan(t testing.TB, tasks ...string) bool {
+	t.Helper()
+	ok := true
+	for _, task := range tasks {
+		if _, found := r.span(task); !found {
+			t.Errorf("expected task %s to run, started tasks: %v", task, r.StartOrder())
+			ok = false
+		}
+	}
+	return ok
+}
+
+// AssertNotRan checks that none of tasks started
+func (r *Recorder) AssertNotRan(t testing.TB, tasks ...string) bool {
+	t.Helper()
+	ok := true
+	for _, task := range tasks {
+		if _, found := r.span(task); found {
+			t.Errorf("expected task %s not to run", task)
+			ok = false
+		}
+	}
+	return ok
+}
+
+// AssertStartedAfter checks that later started after earlier finished
+func (r *Recorder) AssertStartedAfter(t testing.TB, later string, earlier string) bool {
+	t.Helper()
+	if !r.AssertRan(t, later, earlier) {
+		return false
+	}
+	laterSpan, _ := r.span(later)
+	earlierSpan, _ := r.span(earlier)
+	if earlierSpan.finish == 0 || laterSpan.start < earlierSpan.finish {
+		t.Errorf("expected %s to start after %s finished, events: %v", later, earlier, r.Events())
+		return false
+	}
+	return true
+}
+
+// AssertParallel checks that every two of tasks were running at the same time
+func (r *Recorder) AssertParallel(t testing.TB, tasks ...string) bool {
+	t.Helper()
+	if !r.AssertRan(t, tasks...) {
+		return false
+	}
+	ok := true
+	for i := range tasks {
+		for j := i + 1; j < len(tasks); j++ {
+			a, _ := r.span(tasks[i])
+			b, _ := r.span(tasks[j])
+			if !overlaps(a, b) {
+				t.Errorf("expected %s and %s to run in parallel, events: %v", tasks[i], tasks[j], r.Events())
+				ok = false
+			}
+		}
+	}
+	return ok
+}
+
+// AssertMaxConcurrency checks that at most n tasks were running at the same time
+func (r *Recorder) AssertMaxConcurrency(t testing.TB, n int) bool {
+	t.Helper()
+	if got := r.MaxConcurrency(); got > n {
+		t.Errorf("expected at most %d tasks running at the same time, got %d", n, got)
+		return false
+	}
+	return true
+}
+
+// overlaps reports whether two spans share a moment, an unfinished span lasts forever
+func overlaps(a, b span) bool {
+	aFinish, bFinish := a.finish, b.finish
+	if aFinish == 0 {
+		aFinish = math.MaxInt
+	}
+	if bFinish == 0 {
+		bFinish = math.MaxInt
+	}
+	return a.start < bFinish && b.start < aFinish
+}
@@ -0,0 +1,198 @@
+package dagflowtest
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Steve-Lee-CST/go-pico-tool/pkg/task_dagflow"
+)
+
+// Gate blocks tasks until it is opened, it replaces time.Sleep when a test needs
+// a task to be running (or not yet finished) at a given point.
+type Gate struct {
+	once sync.Once
+	ch   chan struct{}
+}
+
+func NewGate() *Gate {
+	return &Gate{ch: make(chan struct{})}
+}
+
+// Open releases all current and future waiters, it can be called more than once
+func (g *Gate) Open() {
+	g.once.Do(func() { close(g.ch) })
+}
+
+// Wait blocks until the gate is opened or ctx is done
+func (g *Gate) Wait(ctx context.Context) error {
+	select {
+	case <-g.ch:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Barrier blocks tasks until n of them are waiting at the same time.
+// Tasks passing a barrier of n are proven to have run in parallel.
+type Barrier struct {
+	arrived atomic.Int32
+	n       int32
+	gate    *Gate
+}
+
+func NewBarrier(n int) *Barrier {
+	return &Barrier{n: int32(n), gate: NewGate()}
+}
+
+// Wait blocks until n tasks arrived or ctx is done
+func (b *Barrier) Wait(ctx context.Context) error {
+	if b.arrived.Add(1) >= b.n {
+		b.gate.Open()
+	}
+	return b.gate.Wait(ctx)
+}
+
+// StubTask is a configurable ITask for tests, by default it succeeds at once without
+// touching the collection. Configure it with the With* methods before registering it.
+type StubTask[CT task_dagflow.ICollection] struct {
+	name       string
+	inputTypes []reflect.Type
+	outputType reflect.Type
+	timeout    time.Duration
+	delay      time.Duration
+	gate       *Gate
+	barrier    *Barrier
+	failTimes  int32
+	err        error
+	panicValue any
+	run        func(ctx context.Context, collection CT) error
+	calls      atomic.Int32
+}
+
+// NewStubTask creates a stub producing output from inputs, without inputs it is a source task
+func NewStubTask[CT task_dagflow.ICollection](
+	name string, output reflect.Type, inputs ...reflect.Type,
+) *StubTask[CT] {
+	if len(inputs) == 0 {
+		inputs = []reflect.Type{nil}
+	}
+	return &StubTask[CT]{
+		name:       name,
+		inputTypes: inputs,
+		outputType: output,
+		timeout:    time.Second,
+	}
+}
+
+// WithTimeout sets the task timeout, default 1s
+func (t *StubTask[CT]) WithTimeout(timeout time.Duration) *StubTask[CT] {
+	t.timeout = timeout
+	return t
+}
+
+// WithDelay makes the task take delay, it returns ctx.Err() if ctx is done earlier
+func (t *StubTask[CT]) WithDelay(delay time.Duration) *StubTask[CT] {
+	t.delay = delay
+	return t
+}
+
+// WithGate makes the task wait for gate to open
+func (t *StubTask[CT]) WithGate(gate *Gate) *StubTask[CT] {
+	t.gate = gate
+	return t
+}
+
+// WithBarrier makes the task wait at barrier
+func (t *StubTask[CT]) WithBarrier(barrier *Barrier) *StubTask[CT] {
+	t.barrier = barrier
+	return t
+}
+
+// WithError makes the task fail with err
+func (t *StubTask[CT]) WithError(err error) *StubTask[CT] {
+	t.err = err
+	return t
+}
+
+// WithFailTimes makes the first n calls fail with the error set by WithError, later calls succeed
+func (t *StubTask[CT]) WithFailTimes(n int) *StubTask[CT] {
+	t.failTimes = int32(n)
+	return t
+}
+
+// WithPanic makes the task panic with value
+func (t *StubTask[CT]) WithPanic(value any) *StubTask[CT] {
+	t.panicValue = value
+	return t
+}
+
+// WithRun sets the function run at the end of a successful call, usually to set the output
+func (t *StubTask[CT]) WithRun(run func(ctx context.Context, collection CT) error) *StubTask[CT] {
+	t.run = run
+	return t
+}
+
+// CreateFunc returns a TaskCreateFunc always creating this stub, so calls are counted across flows
+func (t *StubTask[CT]) CreateFunc() task_dagflow.TaskCreateFunc[CT] {
+	return func() (task_dagflow.ITask[CT], error) {
+		return t, nil
+	}
+}
+
+// Calls returns how many times the task was executed
+func (t *StubTask[CT]) Calls() int {
+	return int(t.calls.Load())
+}
+
+func (t *StubTask[CT]) Name() string {
+	return t.name
+}
+
+func (t *StubTask[CT]) InputTypes() []reflect.Type {
+	return t.inputTypes
+}
+
+func (t *StubTask[CT]) OutputType() reflect.Type {
+	return t.outputType
+}
+
+func (t *StubTask[CT]) Timeout() time.Duration {
+	return t.timeout
+}
+
+func (t *StubTask[CT]) Execute(ctx context.Context, collection CT) error {
+	call := t.calls.Add(1)
+	if t.barrier != nil {
+		if err := t.barrier.Wait(ctx); err != nil {
+			return err
+		}
+	}
+	if t.gate != nil {
+		if err := t.gate.Wait(ctx); err != nil {
+			return err
+		}
+	}
+	if t.delay > 0 {
+		timer := time.NewTimer(t.delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if t.panicValue != nil {
+		panic(t.panicValue)
+	}
+	if t.err != nil && (t.failTimes == 0 || call <= t.failTimes) {
+		return t.err
+	}
+	if t.run != nil {
+		return t.run(ctx, collection)
+	}
+	return nil
+}
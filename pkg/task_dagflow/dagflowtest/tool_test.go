@@ -0,0 +1,135 @@
+package dagflowtest
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Steve-Lee-CST/go-pico-tool/pkg/task_dagflow"
+)
+
+type (
+	Users  []string
+	Orders []string
+	Page   string
+)
+
+type pageCollection struct {
+	users  Users
+	orders Orders
+	page   Page
+}
+
+func (c *pageCollection) InputTypes() []reflect.Type {
+	return []reflect.Type{nil}
+}
+
+func (c *pageCollection) TargetTypes() []reflect.Type {
+	return []reflect.Type{reflect.TypeOf(c.page)}
+}
+
+var (
+	usersType  = reflect.TypeOf(Users{})
+	ordersType = reflect.TypeOf(Orders{})
+	pageType   = reflect.TypeOf(Page(""))
+)
+
+func newPageFlow(
+	t *testing.T, recorder *Recorder, tasks ...*StubTask[*pageCollection],
+) *task_dagflow.TaskDagflow[*pageCollection] {
+	t.Helper()
+	factory := task_dagflow.NewFactoryWithConfig[*pageCollection](task_dagflow.Config{Name: "page"})
+	factory.Use(RecordInterceptor[*pageCollection](recorder))
+	for _, task := range tasks {
+		if err := factory.RegisterTask(task.CreateFunc()); err != nil {
+			t.Fatalf("failed to register %s: %v", task.Name(), err)
+		}
+	}
+	if err := factory.CreateGraph(); err != nil {
+		t.Fatalf("failed to create graph: %v", err)
+	}
+	flow, err := factory.CreateTaskDagflow(&pageCollection{})
+	if err != nil {
+		t.Fatalf("failed to create flow: %v", err)
+	}
+	return flow
+}
+
+func TestRecorder_OrderAndParallel(t *testing.T) {
+	recorder := NewRecorder()
+	barrier := NewBarrier(2)
+	users := NewStubTask[*pageCollection]("UsersTask", usersType).WithBarrier(barrier)
+	orders := NewStubTask[*pageCollection]("OrdersTask", ordersType).WithBarrier(barrier)
+	page := NewStubTask[*pageCollection]("PageTask", pageType, usersType, ordersType).
+		WithRun(func(ctx context.Context, c *pageCollection) error {
+			c.page = "ok"
+			return nil
+		})
+
+	flow := newPageFlow(t, recorder, users, orders, page)
+	if err := flow.Execute(context.Background(), time.Second); err != nil {
+		t.Fatalf("flow failed: %v", err)
+	}
+	recorder.AssertParallel(t, "UsersTask", "OrdersTask")
+	recorder.AssertStartedAfter(t, "PageTask", "UsersTask")
+	recorder.AssertStartedAfter(t, "PageTask", "OrdersTask")
+	recorder.AssertMaxConcurrency(t, 2)
+	if page.Calls() != 1 {
+		t.Errorf("expected PageTask to be called once, got %d", page.Calls())
+	}
+	AssertGoldenReport(t, flow.Report(), "testdata/page_success.json")
+}
+
+func TestRecorder_Failure(t *testing.T) {
+	recorder := NewRecorder()
+	// OrdersTask is still running when UsersTask fails
+	barrier, gate := NewBarrier(2), NewGate()
+	users := NewStubTask[*pageCollection]("UsersTask", usersType).
+		WithBarrier(barrier).WithError(errors.New("users unavailable"))
+	orders := NewStubTask[*pageCollection]("OrdersTask", ordersType).WithBarrier(barrier).WithGate(gate)
+	page := NewStubTask[*pageCollection]("PageTask", pageType, usersType, ordersType)
+
+	flow := newPageFlow(t, recorder, users, orders, page)
+	err := flow.Execute(context.Background(), time.Second)
+	gate.Open()
+	if err == nil {
+		t.Fatal("expected flow to fail")
+	}
+	recorder.AssertRan(t, "UsersTask", "OrdersTask")
+	recorder.AssertNotRan(t, "PageTask")
+	AssertGoldenReport(t, flow.Report(), "testdata/page_failure.json")
+}
+
+func TestStubTask(t *testing.T) {
+	ctx := context.Background()
+	collection := &pageCollection{}
+	stubErr := errors.New("flaky")
+
+	flaky := NewStubTask[*pageCollection]("FlakyTask", usersType).WithError(stubErr).WithFailTimes(2)
+	for i, expected := range []error{stubErr, stubErr, nil} {
+		if err := flaky.Execute(ctx, collection); !errors.Is(err, expected) {
+			t.Errorf("call %d: expected %v, got %v", i+1, expected, err)
+		}
+	}
+
+	slow := NewStubTask[*pageCollection]("SlowTask", usersType).WithDelay(time.Hour)
+	cancelCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := slow.Execute(cancelCtx, collection); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected delay to stop at ctx done, got %v", err)
+	}
+
+	recorder := NewRecorder()
+	panicking := NewStubTask[*pageCollection]("PanicTask", usersType).WithPanic("boom")
+	handler := RecordInterceptor[*pageCollection](recorder)
+	func() {
+		defer func() { _ = recover() }()
+		_ = handler(ctx, task_dagflow.TaskInfo{Name: panicking.Name()}, collection, panicking.Execute)
+	}()
+	events := recorder.Events()
+	if len(events) != 2 || events[1].Kind != EventFinish || !errors.Is(events[1].Err, task_dagflow.ErrTaskPanic) {
+		t.Errorf("expected panic to be recorded as a finish, got %v", events)
+	}
+}
@@ -2,12 +2,27 @@ package task_dagflow
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"reflect"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
 
+// sleepWithContext simulates a remote call which gives up once ctx is done
+func sleepWithContext(ctx context.Context, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
+
 type Goods struct {
 	ID    string
 	Name  string
@@ -39,6 +54,7 @@ type GoodsInShops struct {
 }
 
 type GoodsInShopsCollection struct {
+	bucket       string
 	shops        []Shop
 	goods        []Goods
 	goodsInShops GoodsInShops
@@ -279,6 +295,72 @@ func TestNormal(t *testing.T) {
 	fmt.Printf("task dagflow cost: %v\n", taskDagflow.timeCost)
 }
 
+// GoodsCount is computed from the goods given by the caller
+type GoodsCount int
+
+// goodsCountCollection has the goods as input, its flow has no source task
+type goodsCountCollection struct {
+	goods []Goods
+	count GoodsCount
+}
+
+func (c *goodsCountCollection) InputTypes() []reflect.Type {
+	return []reflect.Type{reflect.TypeOf(c.goods)}
+}
+
+func (c *goodsCountCollection) TargetTypes() []reflect.Type {
+	return []reflect.Type{reflect.TypeOf(c.count)}
+}
+
+type goodsCountTask struct{}
+
+func (t *goodsCountTask) Name() string {
+	return "GoodsCountTask"
+}
+
+func (t *goodsCountTask) InputTypes() []reflect.Type {
+	return []reflect.Type{reflect.TypeOf([]Goods{})}
+}
+
+func (t *goodsCountTask) OutputType() reflect.Type {
+	return reflect.TypeOf(GoodsCount(0))
+}
+
+func (t *goodsCountTask) Timeout() time.Duration {
+	return 500 * time.Millisecond
+}
+
+func (t *goodsCountTask) Execute(ctx context.Context, collection *goodsCountCollection) error {
+	time.Sleep(50 * time.Millisecond)
+	collection.count = GoodsCount(len(collection.goods))
+	return nil
+}
+
+func TestCollectionInputs(t *testing.T) {
+	factory := NewFactory[*goodsCountCollection]()
+	if err := factory.RegisterTask(func() (ITask[*goodsCountCollection], error) {
+		return &goodsCountTask{}, nil
+	}); err != nil {
+		t.Fatalf("failed to register GoodsCountTask: %v", err)
+	}
+
+	factory.CreateGraph()
+
+	collection := &goodsCountCollection{goods: GoodsData}
+	taskDagflow, err := factory.CreateTaskDagflow(collection)
+	if err != nil {
+		t.Fatalf("failed to create TaskDagflow: %v", err)
+	}
+
+	// the flow must not finish before the task unblocked by the collection input ran
+	if err := taskDagflow.Execute(context.Background(), 2*time.Second); err != nil {
+		t.Fatalf("task dagflow execution failed: %v", err)
+	}
+	if collection.count != GoodsCount(len(GoodsData)) {
+		t.Fatalf("expected %d goods, got %d", len(GoodsData), collection.count)
+	}
+}
+
 func TestTaskTimeout(t *testing.T) {
 	factory := NewFactory[*GoodsInShopsCollection]()
 	if err := factory.RegisterTask(NewGetGoodsTaskCreateFunc[*GoodsInShopsCollection](
@@ -307,6 +389,12 @@ func TestTaskTimeout(t *testing.T) {
 	if err == nil {
 		t.Fatal("expected task dagflow execution to fail due to task timeout, but it succeeded")
 	}
+	var taskErr *TaskError
+	var timeoutErr *TaskTimeoutError
+	if !errors.As(err, &taskErr) || !errors.As(err, &timeoutErr) || !errors.Is(err, ErrTaskTimeout) ||
+		timeoutErr.TaskName != taskErr.TaskName || timeoutErr.Timeout != 150*time.Millisecond {
+		t.Fatalf("expected a task timeout error, got %v", err)
+	}
 	fmt.Printf("task dagflow execution failed as expected: %v\n", err)
 	fmt.Printf("task dagflow cost: %v\n", taskDagflow.timeCost)
 }
@@ -339,6 +427,1901 @@ func TestFlowTimeout(t *testing.T) {
 	if err == nil {
 		t.Fatal("expected task dagflow execution to fail due to task timeout, but it succeeded")
 	}
+	var flowErr *FlowTimeoutError
+	if !errors.As(err, &flowErr) || flowErr.Timeout != 200*time.Millisecond ||
+		!errors.Is(err, ErrFlowTimeout) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a flow timeout error, got %v", err)
+	}
 	fmt.Printf("task dagflow execution failed as expected: %v\n", err)
 	fmt.Printf("task dagflow cost: %v\n", taskDagflow.timeCost)
 }
+
+func TestRunReport(t *testing.T) {
+	factory := NewFactoryWithConfig[*GoodsInShopsCollection](Config{Name: "goods_in_shops"})
+	if err := factory.RegisterTask(NewGetGoodsTaskCreateFunc[*GoodsInShopsCollection](
+		"GetGoodsTask", 500*time.Millisecond)); err != nil {
+		t.Fatalf("failed to register GetGoodsTask: %v", err)
+	}
+	if err := factory.RegisterTask(NewGetShopsTaskCreateFunc[*GoodsInShopsCollection](
+		"GetShopsTask", 500*time.Millisecond)); err != nil {
+		t.Fatalf("failed to register GetShopsTask: %v", err)
+	}
+	if err := factory.RegisterTask(NewGoodsInShopsTaskCreateFunc[*GoodsInShopsCollection](
+		"GoodsInShopsTask", 500*time.Millisecond)); err != nil {
+		t.Fatalf("failed to register GoodsInShopsTask: %v", err)
+	}
+	var observed []*RunReport
+	factory.AddRunObserver(func(report *RunReport) {
+		observed = append(observed, report)
+	})
+
+	if err := factory.CreateGraph(); err != nil {
+		t.Fatalf("failed to create graph: %v", err)
+	}
+
+	spec := factory.GraphSpec()
+	if spec.Name != "goods_in_shops" || len(spec.Tasks) != 3 {
+		t.Fatalf("unexpected graph spec: %+v", spec)
+	}
+	if spec.Tasks[2].Name != "GoodsInShopsTask" || len(spec.Tasks[2].InputTypes) != 2 {
+		t.Fatalf("expected tasks sorted by name with inputs, got %+v", spec.Tasks)
+	}
+
+	collection := &GoodsInShopsCollection{}
+	taskDagflow, err := factory.CreateTaskDagflow(collection)
+	if err != nil {
+		t.Fatalf("failed to create TaskDagflow: %v", err)
+	}
+	// GetGoodsTask finishes, GetShopsTask is still running and GoodsInShopsTask never starts
+	if err := taskDagflow.Execute(context.Background(), 150*time.Millisecond); err == nil {
+		t.Fatal("expected task dagflow execution to time out")
+	}
+
+	report := taskDagflow.Report()
+	if len(observed) != 1 || observed[0] != report {
+		t.Fatalf("expected observer to receive the report once, got %d", len(observed))
+	}
+	if report.FlowName != "goods_in_shops" || report.Status != RunStatusFailed || report.Error == "" {
+		t.Fatalf("unexpected run report: %+v", report)
+	}
+	statuses := make(map[string]TaskStatus)
+	for _, task := range report.Tasks {
+		statuses[task.Name] = task.Status
+	}
+	expected := map[string]TaskStatus{
+		"GetGoodsTask":     TaskStatusSuccess,
+		"GetShopsTask":     TaskStatusUnfinished,
+		"GoodsInShopsTask": TaskStatusSkipped,
+	}
+	if !reflect.DeepEqual(statuses, expected) {
+		t.Fatalf("expected task statuses %v, got %v", expected, statuses)
+	}
+}
+
+func TestInterceptors(t *testing.T) {
+	var (
+		lock   sync.Mutex
+		events []string
+	)
+	record := func(tag string) Interceptor[*GoodsInShopsCollection] {
+		return func(ctx context.Context, info TaskInfo, collection *GoodsInShopsCollection,
+			next TaskHandler[*GoodsInShopsCollection]) error {
+			lock.Lock()
+			events = append(events, tag+":before:"+info.Name)
+			lock.Unlock()
+			err := next(ctx, collection)
+			lock.Lock()
+			events = append(events, tag+":after:"+info.Name)
+			lock.Unlock()
+			return err
+		}
+	}
+
+	factory := NewFactory[*GoodsInShopsCollection]()
+	factory.Use(record("outer"))
+	if err := factory.RegisterTask(NewGetGoodsTaskCreateFunc[*GoodsInShopsCollection](
+		"GetGoodsTask", 500*time.Millisecond)); err != nil {
+		t.Fatalf("failed to register GetGoodsTask: %v", err)
+	}
+	if err := factory.RegisterTask(NewGetShopsTaskCreateFunc[*GoodsInShopsCollection](
+		"GetShopsTask", 500*time.Millisecond)); err != nil {
+		t.Fatalf("failed to register GetShopsTask: %v", err)
+	}
+	if err := factory.RegisterTask(NewGoodsInShopsTaskCreateFunc[*GoodsInShopsCollection](
+		"GoodsInShopsTask", 500*time.Millisecond), WithInterceptors(record("inner"))); err != nil {
+		t.Fatalf("failed to register GoodsInShopsTask: %v", err)
+	}
+
+	factory.CreateGraph()
+
+	taskDagflow, err := factory.CreateTaskDagflow(&GoodsInShopsCollection{})
+	if err != nil {
+		t.Fatalf("failed to create TaskDagflow: %v", err)
+	}
+	if err := taskDagflow.Execute(context.Background(), 2*time.Second); err != nil {
+		t.Fatalf("task dagflow execution failed: %v", err)
+	}
+
+	expectedTail := []string{
+		"outer:before:GoodsInShopsTask",
+		"inner:before:GoodsInShopsTask",
+		"inner:after:GoodsInShopsTask",
+		"outer:after:GoodsInShopsTask",
+	}
+	if len(events) != 8 || !reflect.DeepEqual(events[4:], expectedTail) {
+		t.Fatalf("unexpected interceptor events: %v", events)
+	}
+}
+
+func TestInterceptorFaultInjection(t *testing.T) {
+	errInjected := errors.New("injected fault")
+	factory := NewFactory[*GoodsInShopsCollection]()
+	factory.Use(func(ctx context.Context, info TaskInfo, collection *GoodsInShopsCollection,
+		next TaskHandler[*GoodsInShopsCollection]) error {
+		if info.Name == "GetShopsTask" {
+			return errInjected // short-circuit, the task itself never runs
+		}
+		return next(ctx, collection)
+	})
+	if err := factory.RegisterTask(NewGetGoodsTaskCreateFunc[*GoodsInShopsCollection](
+		"GetGoodsTask", 500*time.Millisecond)); err != nil {
+		t.Fatalf("failed to register GetGoodsTask: %v", err)
+	}
+	if err := factory.RegisterTask(NewGetShopsTaskCreateFunc[*GoodsInShopsCollection](
+		"GetShopsTask", 500*time.Millisecond)); err != nil {
+		t.Fatalf("failed to register GetShopsTask: %v", err)
+	}
+	if err := factory.RegisterTask(NewGoodsInShopsTaskCreateFunc[*GoodsInShopsCollection](
+		"GoodsInShopsTask", 500*time.Millisecond)); err != nil {
+		t.Fatalf("failed to register GoodsInShopsTask: %v", err)
+	}
+
+	factory.CreateGraph()
+
+	collection := &GoodsInShopsCollection{}
+	taskDagflow, err := factory.CreateTaskDagflow(collection)
+	if err != nil {
+		t.Fatalf("failed to create TaskDagflow: %v", err)
+	}
+	err = taskDagflow.Execute(context.Background(), 2*time.Second)
+	if !errors.Is(err, errInjected) {
+		t.Fatalf("expected injected fault, got %v", err)
+	}
+	if collection.GetShops() != nil {
+		t.Fatal("expected GetShopsTask to be short-circuited")
+	}
+}
+
+type CachedShopsTask[CT IShop] struct {
+	name string
+}
+
+func NewCachedShopsTaskCreateFunc[CT IShop](name string) TaskCreateFunc[CT] {
+	return func() (ITask[CT], error) {
+		return &CachedShopsTask[CT]{name: name}, nil
+	}
+}
+
+func (t *CachedShopsTask[CT]) Name() string {
+	return t.name
+}
+
+func (t *CachedShopsTask[CT]) InputTypes() []reflect.Type {
+	return []reflect.Type{nil}
+}
+
+func (t *CachedShopsTask[CT]) OutputType() reflect.Type {
+	return reflect.TypeOf([]Shop{})
+}
+
+func (t *CachedShopsTask[CT]) Timeout() time.Duration {
+	return 50 * time.Millisecond
+}
+
+func (t *CachedShopsTask[CT]) Execute(ctx context.Context, collection CT) error {
+	collection.SetShops(ShopsData[:1])
+	return nil
+}
+
+// RemoteShopsTask fetches the shops like GetShopsTask but gives up once ctx is done
+type RemoteShopsTask[CT IShop] struct {
+	*GetShopsTask[CT]
+}
+
+func NewRemoteShopsTaskCreateFunc[CT IShop](name string, timeout time.Duration) TaskCreateFunc[CT] {
+	return func() (ITask[CT], error) {
+		return &RemoteShopsTask[CT]{GetShopsTask: NewGetShopsTask[CT](name, timeout)}, nil
+	}
+}
+
+func (t *RemoteShopsTask[CT]) Execute(ctx context.Context, collection CT) error {
+	if err := sleepWithContext(ctx, 200*time.Millisecond); err != nil {
+		return err
+	}
+	collection.SetShops(ShopsData)
+	return nil
+}
+
+func newFallbackFactory(t *testing.T, shops TaskCreateFunc[*GoodsInShopsCollection], options ...TaskOption[*GoodsInShopsCollection]) *Factory[*GoodsInShopsCollection] {
+	factory := NewFactory[*GoodsInShopsCollection]()
+	if err := factory.RegisterFallbackTask(NewCachedShopsTaskCreateFunc[*GoodsInShopsCollection](
+		"CachedShopsTask")); err == nil {
+		t.Fatal("expected fallback without primary task to be rejected")
+	}
+	if err := factory.RegisterTask(NewGetGoodsTaskCreateFunc[*GoodsInShopsCollection](
+		"GetGoodsTask", 500*time.Millisecond)); err != nil {
+		t.Fatalf("failed to register GetGoodsTask: %v", err)
+	}
+	if err := factory.RegisterTask(shops); err != nil {
+		t.Fatalf("failed to register GetShopsTask: %v", err)
+	}
+	if err := factory.RegisterFallbackTask(NewCachedShopsTaskCreateFunc[*GoodsInShopsCollection](
+		"CachedShopsTask"), options...); err != nil {
+		t.Fatalf("failed to register CachedShopsTask: %v", err)
+	}
+	if err := factory.RegisterTask(NewGoodsInShopsTaskCreateFunc[*GoodsInShopsCollection](
+		"GoodsInShopsTask", 500*time.Millisecond)); err != nil {
+		t.Fatalf("failed to register GoodsInShopsTask: %v", err)
+	}
+	if err := factory.CreateGraph(); err != nil {
+		t.Fatalf("failed to create graph: %v", err)
+	}
+	return factory
+}
+
+func producerOf(report *RunReport, name string) string {
+	for _, task := range report.Tasks {
+		if task.Name == name {
+			return task.Producer
+		}
+	}
+	return ""
+}
+
+func TestFallbackOnTimeout(t *testing.T) {
+	// GetShopsTask sleeps 200ms and times out, CachedShopsTask supplies the shops
+	factory := newFallbackFactory(t, NewGetShopsTaskCreateFunc[*GoodsInShopsCollection]("GetShopsTask", 100*time.Millisecond))
+	if spec := factory.GraphSpec(); len(spec.Tasks[1].Fallbacks) != 1 {
+		t.Fatalf("expected fallback in graph spec, got %+v", spec.Tasks[1])
+	}
+
+	collection := &GoodsInShopsCollection{}
+	taskDagflow, err := factory.CreateTaskDagflow(collection)
+	if err != nil {
+		t.Fatalf("failed to create TaskDagflow: %v", err)
+	}
+	if err := taskDagflow.Execute(context.Background(), 2*time.Second); err != nil {
+		t.Fatalf("task dagflow execution failed: %v", err)
+	}
+	if len(collection.GetGoodsInShops().ShopToGoods) == 0 {
+		t.Fatal("expected goods in shops, but got none")
+	}
+	if producer := producerOf(taskDagflow.Report(), "GetShopsTask"); producer != "CachedShopsTask" {
+		t.Fatalf("expected CachedShopsTask to be the producer, got %q", producer)
+	}
+	if producer := producerOf(taskDagflow.Report(), "GetGoodsTask"); producer != "GetGoodsTask" {
+		t.Fatalf("expected GetGoodsTask to be the producer, got %q", producer)
+	}
+}
+
+// TestFallbackLatePrimary runs with -race: the primary ignores its ctx and returns after its timeout,
+// the fallback starts once it returned and the primary must not write the shops it gave up on
+func TestFallbackLatePrimary(t *testing.T) {
+	for kind, newTask := range map[string]func(name string, delay time.Duration) TaskCreateFunc[*GoodsInShopsCollection]{
+		"typed": func(name string, delay time.Duration) TaskCreateFunc[*GoodsInShopsCollection] {
+			return NewTask0(name, 20*time.Millisecond, (*GoodsInShopsCollection).SetShops,
+				func(ctx context.Context) ([]Shop, error) {
+					time.Sleep(delay)
+					return ShopsData[:1], nil
+				}).CreateFunc()
+		},
+		"func": func(name string, delay time.Duration) TaskCreateFunc[*GoodsInShopsCollection] {
+			return NewFuncTaskCreateFunc[*GoodsInShopsCollection](name, 20*time.Millisecond,
+				func(ctx context.Context) ([]Shop, error) {
+					time.Sleep(delay)
+					return ShopsData[:1], nil
+				})
+		},
+	} {
+		t.Run(kind, func(t *testing.T) {
+			factory := NewFactory[*GoodsInShopsCollection]()
+			for _, err := range []error{
+				factory.RegisterTask(NewGetGoodsTaskCreateFunc[*GoodsInShopsCollection]("GetGoodsTask", 500*time.Millisecond)),
+				factory.RegisterTask(newTask("SlowShopsTask", 100*time.Millisecond)),
+				factory.RegisterFallbackTask(newTask("CachedShopsTask", 0)),
+				factory.RegisterTask(NewGoodsInShopsTaskCreateFunc[*GoodsInShopsCollection]("GoodsInShopsTask", 500*time.Millisecond)),
+				factory.CreateGraph(),
+			} {
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			collection := &GoodsInShopsCollection{}
+			flow, err := factory.CreateTaskDagflow(collection)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := flow.Execute(context.Background(), 2*time.Second); err != nil {
+				t.Fatal(err)
+			}
+			if producer := producerOf(flow.Report(), "SlowShopsTask"); producer != "CachedShopsTask" {
+				t.Errorf("expected CachedShopsTask to be the producer, got %q", producer)
+			}
+		})
+	}
+}
+
+func TestFallbackHedged(t *testing.T) {
+	// GetShopsTask would succeed after 200ms, but the hedged fallback starts after 50ms and wins.
+	// Raced producers run at the same time, RemoteShopsTask stops writing once it lost.
+	factory := newFallbackFactory(t,
+		NewRemoteShopsTaskCreateFunc[*GoodsInShopsCollection]("GetShopsTask", 500*time.Millisecond),
+		WithHedgeDelay[*GoodsInShopsCollection](50*time.Millisecond))
+
+	taskDagflow, err := factory.CreateTaskDagflow(&GoodsInShopsCollection{})
+	if err != nil {
+		t.Fatalf("failed to create TaskDagflow: %v", err)
+	}
+	if err := taskDagflow.Execute(context.Background(), 2*time.Second); err != nil {
+		t.Fatalf("task dagflow execution failed: %v", err)
+	}
+	report := taskDagflow.Report()
+	if producer := producerOf(report, "GetShopsTask"); producer != "CachedShopsTask" {
+		t.Fatalf("expected CachedShopsTask to win the race, got %q", producer)
+	}
+	for _, task := range report.Tasks {
+		if task.Name == "GetShopsTask" && task.TimeCost >= 200*time.Millisecond {
+			t.Fatalf("expected hedged fallback to finish early, cost %v", task.TimeCost)
+		}
+	}
+}
+
+type IGoodsOnly interface {
+	ICollection
+	GetGoods() []Goods
+	SetGoodsInShops(goodsInShops GoodsInShops)
+}
+
+// ShopRank is produced by a variant no target depends on
+type ShopRank int
+
+// AllGoodsInOneShopTask is the experiment arm of GoodsInShopsTask: it needs no shops
+type AllGoodsInOneShopTask[CT IGoodsOnly] struct {
+	name string
+}
+
+func NewAllGoodsInOneShopTaskCreateFunc[CT IGoodsOnly](name string) TaskCreateFunc[CT] {
+	return func() (ITask[CT], error) {
+		return &AllGoodsInOneShopTask[CT]{name: name}, nil
+	}
+}
+
+func (t *AllGoodsInOneShopTask[CT]) Name() string {
+	return t.name
+}
+
+func (t *AllGoodsInOneShopTask[CT]) InputTypes() []reflect.Type {
+	return AutoInputTypes[IGoodsOnly]()
+}
+
+func (t *AllGoodsInOneShopTask[CT]) OutputType() reflect.Type {
+	return AutoOutputType[IGoodsOnly]()
+}
+
+func (t *AllGoodsInOneShopTask[CT]) Timeout() time.Duration {
+	return 100 * time.Millisecond
+}
+
+func (t *AllGoodsInOneShopTask[CT]) Execute(ctx context.Context, collection CT) error {
+	collection.SetGoodsInShops(GoodsInShops{ShopToGoods: map[string][]Goods{"*": collection.GetGoods()}})
+	return nil
+}
+
+func TestVariantTasks(t *testing.T) {
+	factory := NewFactory[*GoodsInShopsCollection]()
+	if err := factory.RegisterTask(NewGetGoodsTaskCreateFunc[*GoodsInShopsCollection](
+		"GetGoodsTask", 500*time.Millisecond)); err != nil {
+		t.Fatalf("failed to register GetGoodsTask: %v", err)
+	}
+	if err := factory.RegisterTask(NewGetShopsTaskCreateFunc[*GoodsInShopsCollection](
+		"GetShopsTask", 500*time.Millisecond)); err != nil {
+		t.Fatalf("failed to register GetShopsTask: %v", err)
+	}
+	var intercepted sync.Map
+	if err := factory.RegisterVariantTasks(
+		func(collection *GoodsInShopsCollection) string {
+			if collection.bucket == "B" {
+				return "AllGoodsInOneShopTask"
+			}
+			return "GoodsInShopsTask"
+		},
+		[]TaskCreateFunc[*GoodsInShopsCollection]{
+			NewGoodsInShopsTaskCreateFunc[*GoodsInShopsCollection]("GoodsInShopsTask", 500*time.Millisecond),
+			NewAllGoodsInOneShopTaskCreateFunc[*GoodsInShopsCollection]("AllGoodsInOneShopTask"),
+		},
+		WithInterceptors(func(ctx context.Context, info TaskInfo, collection *GoodsInShopsCollection, next TaskHandler[*GoodsInShopsCollection]) error {
+			intercepted.Store(collection.bucket, info.Name)
+			return next(ctx, collection)
+		}),
+	); err != nil {
+		t.Fatalf("failed to register variants: %v", err)
+	}
+	// the selector of an experiment the targets don't depend on is never called
+	var unrelatedSelected atomic.Bool
+	if err := factory.RegisterVariantTasks(
+		func(collection *GoodsInShopsCollection) string {
+			unrelatedSelected.Store(true)
+			return "UnknownRankTask"
+		},
+		[]TaskCreateFunc[*GoodsInShopsCollection]{
+			NewTask1("RankShopsTask", time.Second, (*GoodsInShopsCollection).GetShops,
+				func(*GoodsInShopsCollection, ShopRank) {},
+				func(ctx context.Context, shops []Shop) (ShopRank, error) { return ShopRank(len(shops)), nil }).CreateFunc(),
+		},
+	); err != nil {
+		t.Fatalf("failed to register unrelated variants: %v", err)
+	}
+	if err := factory.RegisterTask(NewGoodsInShopsTaskCreateFunc[*GoodsInShopsCollection](
+		"GoodsInShopsTask", 500*time.Millisecond)); err == nil {
+		t.Fatal("expected duplicated output type to be rejected")
+	}
+
+	factory.CreateGraph()
+
+	for bucket, expected := range map[string][]string{
+		"A": {"GetGoodsTask", "GetShopsTask", "GoodsInShopsTask"},
+		"B": {"AllGoodsInOneShopTask", "GetGoodsTask"}, // GetShopsTask is pruned
+		"X": {"GetGoodsTask", "GetShopsTask", "GoodsInShopsTask"},
+	} {
+		collection := &GoodsInShopsCollection{bucket: bucket}
+		taskDagflow, err := factory.CreateTaskDagflow(collection)
+		if err != nil {
+			t.Fatalf("failed to create TaskDagflow: %v", err)
+		}
+		if err := taskDagflow.Execute(context.Background(), 2*time.Second); err != nil {
+			t.Fatalf("task dagflow execution failed: %v", err)
+		}
+		names := make([]string, 0)
+		for _, task := range taskDagflow.Report().Tasks {
+			names = append(names, task.Name)
+		}
+		sort.Strings(names)
+		if !reflect.DeepEqual(names, expected) {
+			t.Fatalf("bucket %s: expected tasks %v, got %v", bucket, expected, names)
+		}
+		if len(collection.GetGoodsInShops().ShopToGoods) == 0 {
+			t.Fatalf("bucket %s: expected goods in shops, but got none", bucket)
+		}
+		variant := map[string]string{"B": "AllGoodsInOneShopTask"}[bucket]
+		if variant == "" {
+			variant = "GoodsInShopsTask"
+		}
+		if name, _ := intercepted.Load(bucket); name != variant {
+			t.Fatalf("bucket %s: expected %s to be intercepted, got %v", bucket, variant, name)
+		}
+	}
+	if unrelatedSelected.Load() {
+		t.Fatal("expected the selector of an unrelated variant not to be called")
+	}
+}
+
+func TestFactorySnapshotAndReload(t *testing.T) {
+	factory := NewFactory[*GoodsInShopsCollection]()
+	if _, err := factory.CreateTaskDagflow(&GoodsInShopsCollection{}); !errors.Is(err, ErrGraphNotCreated) {
+		t.Fatalf("expected ErrGraphNotCreated, got %v", err)
+	}
+	if err := factory.CreateGraph(); !errors.Is(err, ErrNoTasks) {
+		t.Fatalf("expected ErrNoTasks, got %v", err)
+	}
+	if _, err := factory.Reload(NewTaskSet[*GoodsInShopsCollection]()); !errors.Is(err, ErrNoTasks) {
+		t.Fatalf("expected ErrNoTasks, got %v", err)
+	}
+	if err := factory.RegisterTask(NewGetGoodsTaskCreateFunc[*GoodsInShopsCollection](
+		"GetGoodsTask", 500*time.Millisecond)); err != nil {
+		t.Fatalf("failed to register GetGoodsTask: %v", err)
+	}
+	if err := factory.RegisterTask(NewGetShopsTaskCreateFunc[*GoodsInShopsCollection](
+		"GetShopsTask", 500*time.Millisecond)); err != nil {
+		t.Fatalf("failed to register GetShopsTask: %v", err)
+	}
+	if err := factory.CreateGraph(); err != nil {
+		t.Fatalf("failed to create graph: %v", err)
+	}
+	snapshot, _ := factory.Snapshot()
+
+	// registering afterwards does not change the built snapshot
+	if err := factory.RegisterTask(NewGoodsInShopsTaskCreateFunc[*GoodsInShopsCollection](
+		"GoodsInShopsTask", 500*time.Millisecond)); err != nil {
+		t.Fatalf("failed to register GoodsInShopsTask: %v", err)
+	}
+	if _, err := factory.CreateTaskDagflow(&GoodsInShopsCollection{}); err == nil {
+		t.Fatal("expected target to be unreachable before the graph is rebuilt")
+	}
+	if err := factory.CreateGraph(); err != nil {
+		t.Fatalf("failed to create graph: %v", err)
+	}
+	if _, err := snapshot.CreateTaskDagflow(&GoodsInShopsCollection{}); err == nil {
+		t.Fatal("expected old snapshot to stay unchanged")
+	}
+	taskDagflow, err := factory.CreateTaskDagflow(&GoodsInShopsCollection{})
+	if err != nil {
+		t.Fatalf("failed to create TaskDagflow: %v", err)
+	}
+
+	// hot reload: swap GetShopsTask for CachedShopsTask
+	tasks := NewTaskSet[*GoodsInShopsCollection]()
+	if err := tasks.RegisterTask(NewGetGoodsTaskCreateFunc[*GoodsInShopsCollection](
+		"GetGoodsTask", 500*time.Millisecond)); err != nil {
+		t.Fatalf("failed to register GetGoodsTask: %v", err)
+	}
+	if err := tasks.RegisterTask(NewCachedShopsTaskCreateFunc[*GoodsInShopsCollection](
+		"CachedShopsTask")); err != nil {
+		t.Fatalf("failed to register CachedShopsTask: %v", err)
+	}
+	if err := tasks.RegisterTask(NewGoodsInShopsTaskCreateFunc[*GoodsInShopsCollection](
+		"GoodsInShopsTask", 500*time.Millisecond)); err != nil {
+		t.Fatalf("failed to register GoodsInShopsTask: %v", err)
+	}
+	reloaded, err := factory.Reload(tasks)
+	if err != nil {
+		t.Fatalf("failed to reload: %v", err)
+	}
+	if snapshot.Version() != 1 || reloaded.Version() != 3 || reloaded.GraphSpec().Version != 3 {
+		t.Fatalf("unexpected snapshot versions: %d, %d", snapshot.Version(), reloaded.Version())
+	}
+
+	// the flow created before the reload keeps its snapshot
+	if err := taskDagflow.Execute(context.Background(), 2*time.Second); err != nil {
+		t.Fatalf("task dagflow execution failed: %v", err)
+	}
+	if report := taskDagflow.Report(); report.GraphVersion != 2 || producerOf(report, "GetShopsTask") == "" {
+		t.Fatalf("expected flow of version 2 with GetShopsTask, got %+v", report)
+	}
+	taskDagflow, err = factory.CreateTaskDagflow(&GoodsInShopsCollection{})
+	if err != nil {
+		t.Fatalf("failed to create TaskDagflow: %v", err)
+	}
+	if err := taskDagflow.Execute(context.Background(), 2*time.Second); err != nil {
+		t.Fatalf("task dagflow execution failed: %v", err)
+	}
+	if report := taskDagflow.Report(); report.GraphVersion != 3 || producerOf(report, "CachedShopsTask") == "" {
+		t.Fatalf("expected flow of version 3 with CachedShopsTask, got %+v", report)
+	}
+}
+
+func TestFactoryConcurrentReload(t *testing.T) {
+	factory := NewFactory[*GoodsInShopsCollection]()
+	register := func(r interface {
+		RegisterTask(TaskCreateFunc[*GoodsInShopsCollection], ...TaskOption[*GoodsInShopsCollection]) error
+	}) {
+		_ = r.RegisterTask(NewGetGoodsTaskCreateFunc[*GoodsInShopsCollection]("GetGoodsTask", time.Second))
+		_ = r.RegisterTask(NewCachedShopsTaskCreateFunc[*GoodsInShopsCollection]("CachedShopsTask"))
+		_ = r.RegisterTask(NewGoodsInShopsTaskCreateFunc[*GoodsInShopsCollection]("GoodsInShopsTask", time.Second))
+	}
+	register(factory)
+	_ = factory.CreateGraph()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				if _, err := factory.CreateTaskDagflow(&GoodsInShopsCollection{}); err != nil {
+					t.Errorf("failed to create TaskDagflow: %v", err)
+					return
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			tasks := NewTaskSet[*GoodsInShopsCollection]()
+			register(tasks)
+			if _, err := factory.Reload(tasks); err != nil {
+				t.Errorf("failed to reload: %v", err)
+			}
+			factory.AddRunObserver(func(report *RunReport) {})
+			_ = factory.GraphSpec()
+		}()
+	}
+	wg.Wait()
+	if snapshot, _ := factory.Snapshot(); snapshot.Version() != 9 {
+		t.Fatalf("expected version 9 after 8 reloads, got %d", snapshot.Version())
+	}
+}
+
+// CheckedGoodsInShopsCollection reports every access to its AccessTracker for checked mode
+type CheckedGoodsInShopsCollection struct {
+	AccessTracker
+	shops        []Shop
+	goods        []Goods
+	goodsInShops GoodsInShops
+}
+
+func (c *CheckedGoodsInShopsCollection) InputTypes() []reflect.Type {
+	return []reflect.Type{nil}
+}
+
+func (c *CheckedGoodsInShopsCollection) TargetTypes() []reflect.Type {
+	return []reflect.Type{reflect.TypeOf(c.goodsInShops)}
+}
+
+func (c *CheckedGoodsInShopsCollection) GetShops() []Shop {
+	return TrackedGet(&c.AccessTracker, c.shops)
+}
+
+func (c *CheckedGoodsInShopsCollection) SetShops(shops []Shop) {
+	TrackedSet(&c.AccessTracker, &c.shops, shops)
+}
+
+func (c *CheckedGoodsInShopsCollection) GetGoods() []Goods {
+	return TrackedGet(&c.AccessTracker, c.goods)
+}
+
+func (c *CheckedGoodsInShopsCollection) SetGoods(goods []Goods) {
+	TrackedSet(&c.AccessTracker, &c.goods, goods)
+}
+
+func (c *CheckedGoodsInShopsCollection) GetGoodsInShops() GoodsInShops {
+	return TrackedGet(&c.AccessTracker, c.goodsInShops)
+}
+
+func (c *CheckedGoodsInShopsCollection) SetGoodsInShops(goodsInShops GoodsInShops) {
+	TrackedSet(&c.AccessTracker, &c.goodsInShops, goodsInShops)
+}
+
+// SneakyGoodsInShopsTask declares only goods as input, but reads shops and forgets to set its output
+type SneakyGoodsInShopsTask[CT IGoodsInShops] struct{}
+
+func (t *SneakyGoodsInShopsTask[CT]) Name() string {
+	return "SneakyGoodsInShopsTask"
+}
+
+func (t *SneakyGoodsInShopsTask[CT]) InputTypes() []reflect.Type {
+	return []reflect.Type{reflect.TypeOf([]Goods{})}
+}
+
+func (t *SneakyGoodsInShopsTask[CT]) OutputType() reflect.Type {
+	return reflect.TypeOf(GoodsInShops{})
+}
+
+func (t *SneakyGoodsInShopsTask[CT]) Timeout() time.Duration {
+	return 100 * time.Millisecond
+}
+
+func (t *SneakyGoodsInShopsTask[CT]) Execute(ctx context.Context, collection CT) error {
+	_ = collection.GetShops()
+	return nil
+}
+
+func TestCheckContract(t *testing.T) {
+	factory := NewFactoryWithConfig[*CheckedGoodsInShopsCollection](Config{Name: "checked", CheckContract: true})
+	if err := factory.RegisterTask(NewGetGoodsTaskCreateFunc[*CheckedGoodsInShopsCollection](
+		"GetGoodsTask", 500*time.Millisecond)); err != nil {
+		t.Fatalf("failed to register GetGoodsTask: %v", err)
+	}
+	if err := factory.RegisterTask(NewGetShopsTaskCreateFunc[*CheckedGoodsInShopsCollection](
+		"GetShopsTask", 500*time.Millisecond)); err != nil {
+		t.Fatalf("failed to register GetShopsTask: %v", err)
+	}
+	if err := factory.RegisterTask(NewGoodsInShopsTaskCreateFunc[*CheckedGoodsInShopsCollection](
+		"GoodsInShopsTask", 500*time.Millisecond)); err != nil {
+		t.Fatalf("failed to register GoodsInShopsTask: %v", err)
+	}
+	_ = factory.CreateGraph()
+
+	collection := &CheckedGoodsInShopsCollection{}
+	taskDagflow, err := factory.CreateTaskDagflow(collection)
+	if err != nil {
+		t.Fatalf("failed to create TaskDagflow: %v", err)
+	}
+	if err := taskDagflow.Execute(context.Background(), 2*time.Second); err != nil {
+		t.Fatalf("task dagflow execution failed: %v", err)
+	}
+	for _, task := range taskDagflow.Report().Tasks {
+		if task.Name == "GoodsInShopsTask" &&
+			!reflect.DeepEqual(task.Reads, []string{"[]task_dagflow.Goods", "[]task_dagflow.Shop"}) {
+			t.Fatalf("expected reads of goods and shops, got %v", task.Reads)
+		}
+		if len(task.Writes) != 1 || task.Writes[0] != task.OutputType {
+			t.Fatalf("expected %s to write only its output, got %v", task.Name, task.Writes)
+		}
+	}
+
+	// a sneaky task: undeclared read and output not set
+	tasks := NewTaskSet[*CheckedGoodsInShopsCollection]()
+	_ = tasks.RegisterTask(NewGetGoodsTaskCreateFunc[*CheckedGoodsInShopsCollection]("GetGoodsTask", time.Second))
+	_ = tasks.RegisterTask(NewGetShopsTaskCreateFunc[*CheckedGoodsInShopsCollection]("GetShopsTask", time.Second))
+	_ = tasks.RegisterTask(func() (ITask[*CheckedGoodsInShopsCollection], error) {
+		return &SneakyGoodsInShopsTask[*CheckedGoodsInShopsCollection]{}, nil
+	})
+	if _, err := factory.Reload(tasks); err != nil {
+		t.Fatalf("failed to reload: %v", err)
+	}
+	taskDagflow, err = factory.CreateTaskDagflow(&CheckedGoodsInShopsCollection{})
+	if err != nil {
+		t.Fatalf("failed to create TaskDagflow: %v", err)
+	}
+	err = taskDagflow.Execute(context.Background(), 2*time.Second)
+	var violation *ContractViolationError
+	if !errors.Is(err, ErrContractViolation) || !errors.As(err, &violation) {
+		t.Fatalf("expected contract violation, got %v", err)
+	}
+	if violation.TaskName != "SneakyGoodsInShopsTask" ||
+		!reflect.DeepEqual(violation.UndeclaredReads, []reflect.Type{reflect.TypeOf([]Shop{})}) ||
+		violation.OutputNotSet != reflect.TypeOf(GoodsInShops{}) {
+		t.Fatalf("unexpected violation: %v", violation)
+	}
+
+	// checked mode requires an AccessTracker
+	plain := NewFactoryWithConfig[*GoodsInShopsCollection](Config{CheckContract: true})
+	_ = plain.RegisterTask(NewGetGoodsTaskCreateFunc[*GoodsInShopsCollection]("GetGoodsTask", time.Second))
+	_ = plain.RegisterTask(NewGetShopsTaskCreateFunc[*GoodsInShopsCollection]("GetShopsTask", time.Second))
+	_ = plain.RegisterTask(NewGoodsInShopsTaskCreateFunc[*GoodsInShopsCollection]("GoodsInShopsTask", time.Second))
+	_ = plain.CreateGraph()
+	if _, err := plain.CreateTaskDagflow(&GoodsInShopsCollection{}); err == nil {
+		t.Fatal("expected checked mode to reject a collection without AccessTracker")
+	}
+}
+
+func fetchGoods(ctx context.Context) ([]Goods, error) {
+	return GoodsData, sleepWithContext(ctx, 100*time.Millisecond)
+}
+
+func fetchShops(ctx context.Context) ([]Shop, error) {
+	return ShopsData, sleepWithContext(ctx, 200*time.Millisecond)
+}
+
+func groupGoodsInShops(ctx context.Context, shops []Shop, goods []Goods) (GoodsInShops, error) {
+	goodsByID := make(map[string]Goods, len(goods))
+	for _, good := range goods {
+		goodsByID[good.ID] = good
+	}
+	goodsInShops := GoodsInShops{ShopToGoods: make(map[string][]Goods)}
+	for _, shop := range shops {
+		for _, goodsID := range shop.GoodsIDs {
+			if good, ok := goodsByID[goodsID]; ok {
+				goodsInShops.ShopToGoods[shop.ID] = append(goodsInShops.ShopToGoods[shop.ID], good)
+			}
+		}
+	}
+	return goodsInShops, nil
+}
+
+func TestFuncTask(t *testing.T) {
+	factory := NewFactory[*GoodsInShopsCollection]()
+	for _, createFunc := range []TaskCreateFunc[*GoodsInShopsCollection]{
+		NewFuncTaskCreateFunc[*GoodsInShopsCollection]("GetGoodsTask", 500*time.Millisecond, fetchGoods),
+		NewFuncTaskCreateFunc[*GoodsInShopsCollection]("GetShopsTask", 500*time.Millisecond, fetchShops),
+		NewFuncTaskCreateFunc[*GoodsInShopsCollection]("GoodsInShopsTask", 500*time.Millisecond, groupGoodsInShops),
+	} {
+		if err := factory.RegisterTask(createFunc); err != nil {
+			t.Fatalf("failed to register task: %v", err)
+		}
+	}
+	_ = factory.CreateGraph()
+
+	spec := factory.GraphSpec()
+	if !reflect.DeepEqual(spec.Tasks[2].InputTypes, []string{"[]task_dagflow.Goods", "[]task_dagflow.Shop"}) ||
+		spec.Tasks[2].OutputType != "task_dagflow.GoodsInShops" {
+		t.Fatalf("unexpected types derived from signature: %+v", spec.Tasks[2])
+	}
+
+	collection := &GoodsInShopsCollection{}
+	taskDagflow, err := factory.CreateTaskDagflow(collection)
+	if err != nil {
+		t.Fatalf("failed to create TaskDagflow: %v", err)
+	}
+	if err := taskDagflow.Execute(context.Background(), 2*time.Second); err != nil {
+		t.Fatalf("task dagflow execution failed: %v", err)
+	}
+	if len(collection.GetGoodsInShops().ShopToGoods["3"]) != 3 {
+		t.Fatalf("unexpected goods in shops: %v", collection.GetGoodsInShops())
+	}
+
+	// function tasks bound to a narrow interface see only its methods
+	if _, err := NewFuncTask[IGoodsInShops]("GoodsInShopsTask", time.Second, groupGoodsInShops); err != nil {
+		t.Fatalf("failed to bind to interface collection: %v", err)
+	}
+
+	for _, fn := range []any{
+		nil,
+		"not a function",
+		func(shops []Shop) (GoodsInShops, error) { return GoodsInShops{}, nil },
+		func(ctx context.Context, shops []Shop) GoodsInShops { return GoodsInShops{} },
+		func(ctx context.Context, price int) (GoodsInShops, error) { return GoodsInShops{}, nil },
+		func(ctx context.Context) (int, error) { return 0, nil },
+	} {
+		if _, err := NewFuncTask[*GoodsInShopsCollection]("BadTask", time.Second, fn); err == nil {
+			t.Fatalf("expected %T to be rejected", fn)
+		}
+	}
+}
+
+func TestStatelessTask(t *testing.T) {
+	var statelessCreated, statefulCreated atomic.Int32
+	subtotal := NewTask2("SubtotalTask", time.Second,
+		(*quoteCollection).GetBasePrice, (*quoteCollection).GetQuantity, (*quoteCollection).SetSubtotal,
+		func(ctx context.Context, price QuoteBasePrice, quantity QuoteQuantity) (QuoteSubtotal, error) {
+			return QuoteSubtotal(int(price) * int(quantity)), nil
+		})
+	total := NewTask1("TotalTask", time.Second,
+		(*quoteCollection).GetSubtotal, (*quoteCollection).SetTotal,
+		func(ctx context.Context, subtotal QuoteSubtotal) (QuoteTotal, error) {
+			return QuoteTotal(subtotal), nil
+		})
+	factory := NewFactory[*quoteCollection]()
+	var intercepted atomic.Int32
+	factory.Use(func(ctx context.Context, info TaskInfo, collection *quoteCollection, next TaskHandler[*quoteCollection]) error {
+		intercepted.Add(1)
+		return next(ctx, collection)
+	})
+	for _, err := range []error{
+		factory.RegisterTask(func() (ITask[*quoteCollection], error) {
+			statelessCreated.Add(1)
+			return subtotal, nil
+		}),
+		// a stateful task wrapping the typed one, created for every flow
+		factory.RegisterTask(func() (ITask[*quoteCollection], error) {
+			statefulCreated.Add(1)
+			return struct{ ITask[*quoteCollection] }{total}, nil
+		}),
+		factory.CreateGraph(),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 1; i <= 3; i++ {
+		collection := &quoteCollection{basePrice: 2, quantity: QuoteQuantity(i)}
+		flow, err := factory.CreateTaskDagflow(collection)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := flow.Execute(context.Background(), time.Second); err != nil || collection.total != QuoteTotal(2*i) {
+			t.Fatalf("unexpected run: %v %d", err, collection.total)
+		}
+	}
+	// both are created once at registration, then only the stateful one for every flow
+	if statelessCreated.Load() != 1 || statefulCreated.Load() != 4 {
+		t.Errorf("expected 1 and 4 creations, got %d and %d", statelessCreated.Load(), statefulCreated.Load())
+	}
+	if intercepted.Load() != 6 {
+		t.Errorf("expected interceptors around shared tasks too, got %d calls", intercepted.Load())
+	}
+}
+
+func TestExecuteSequential(t *testing.T) {
+	factory := NewFactoryWithConfig[*GoodsInShopsCollection](Config{Name: "sequential", Sequential: true})
+	_ = factory.RegisterTask(NewGoodsInShopsTaskCreateFunc[*GoodsInShopsCollection]("GoodsInShopsTask", time.Second))
+	_ = factory.RegisterTask(NewGetShopsTaskCreateFunc[*GoodsInShopsCollection]("GetShopsTask", time.Second))
+	_ = factory.RegisterTask(NewGetGoodsTaskCreateFunc[*GoodsInShopsCollection]("GetGoodsTask", time.Second))
+
+	var running, maxRunning int32
+	var mu sync.Mutex
+	factory.Use(func(ctx context.Context, info TaskInfo, c *GoodsInShopsCollection, next TaskHandler[*GoodsInShopsCollection]) error {
+		mu.Lock()
+		running++
+		maxRunning = max(maxRunning, running)
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			running--
+			mu.Unlock()
+		}()
+		return next(ctx, c)
+	})
+	_ = factory.CreateGraph()
+
+	for run := 0; run < 3; run++ {
+		collection := &GoodsInShopsCollection{}
+		taskDagflow, err := factory.CreateTaskDagflow(collection)
+		if err != nil {
+			t.Fatalf("failed to create TaskDagflow: %v", err)
+		}
+		steps := make([]string, 0)
+		err = taskDagflow.ExecuteSequential(context.Background(), 2*time.Second, func(ctx context.Context, step Step) error {
+			steps = append(steps, fmt.Sprintf("%d %s %s %v", step.Index, step.Phase, step.Task, step.Ready))
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("sequential execution failed: %v", err)
+		}
+		expected := []string{
+			"0 before GetGoodsTask [GetShopsTask]",
+			"0 after GetGoodsTask [GetShopsTask]",
+			"1 before GetShopsTask []",
+			"1 after GetShopsTask []",
+			"2 before GoodsInShopsTask []",
+			"2 after GoodsInShopsTask []",
+		}
+		if !reflect.DeepEqual(steps, expected) {
+			t.Fatalf("run %d: unexpected steps %v", run, steps)
+		}
+		if len(collection.GetGoodsInShops().ShopToGoods) == 0 {
+			t.Fatal("expected goods in shops, but got none")
+		}
+	}
+	if maxRunning != 1 {
+		t.Fatalf("expected tasks to run one at a time, got %d at once", maxRunning)
+	}
+
+	// Config.Sequential makes Execute sequential, a hook error stops the run
+	taskDagflow, _ := factory.CreateTaskDagflow(&GoodsInShopsCollection{})
+	if err := taskDagflow.Execute(context.Background(), 2*time.Second); err != nil {
+		t.Fatalf("sequential execution failed: %v", err)
+	}
+	stop := errors.New("stop")
+	taskDagflow, _ = factory.CreateTaskDagflow(&GoodsInShopsCollection{})
+	err := taskDagflow.ExecuteSequential(context.Background(), 2*time.Second, func(ctx context.Context, step Step) error {
+		if step.Task == "GetShopsTask" && step.Phase == StepBefore {
+			return stop
+		}
+		return nil
+	})
+	if !errors.Is(err, stop) {
+		t.Fatalf("expected hook error, got %v", err)
+	}
+	for _, task := range taskDagflow.Report().Tasks {
+		if task.Name != "GetGoodsTask" && task.Status != TaskStatusSkipped {
+			t.Fatalf("expected %s to be skipped, got %s", task.Name, task.Status)
+		}
+	}
+
+	// task timeout and flow timeout
+	taskDagflow, _ = factory.CreateTaskDagflow(&GoodsInShopsCollection{})
+	if err := taskDagflow.ExecuteSequential(context.Background(), 150*time.Millisecond, nil); err == nil {
+		t.Fatal("expected flow timeout")
+	}
+}
+
+func TestTypedErrors(t *testing.T) {
+	newFactory := func(funcs map[string]any) *Factory[*GoodsInShopsCollection] {
+		factory := NewFactory[*GoodsInShopsCollection]()
+		for name, fn := range funcs {
+			if err := factory.RegisterTask(NewFuncTaskCreateFunc[*GoodsInShopsCollection](name, 500*time.Millisecond, fn)); err != nil {
+				t.Fatalf("failed to register %s: %v", name, err)
+			}
+		}
+		_ = factory.CreateGraph()
+		return factory
+	}
+
+	// a panic is reported with the task and its stack, by both executors
+	factory := newFactory(map[string]any{
+		"GetGoodsTask": fetchGoods,
+		"GetShopsTask": func(ctx context.Context) ([]Shop, error) {
+			panic("shops unavailable")
+		},
+		"GoodsInShopsTask": groupGoodsInShops,
+	})
+	for _, sequential := range []bool{false, true} {
+		taskDagflow, err := factory.CreateTaskDagflow(&GoodsInShopsCollection{})
+		if err != nil {
+			t.Fatalf("failed to create TaskDagflow: %v", err)
+		}
+		if sequential {
+			err = taskDagflow.ExecuteSequential(context.Background(), time.Second, nil)
+		} else {
+			err = taskDagflow.Execute(context.Background(), time.Second)
+		}
+		var panicErr *PanicError
+		if !errors.Is(err, ErrTaskPanic) || !errors.As(err, &panicErr) ||
+			panicErr.TaskName != "GetShopsTask" || panicErr.Value != "shops unavailable" || len(panicErr.Stack) == 0 ||
+			panicErr.OutputType != reflect.TypeOf([]Shop{}) {
+			t.Fatalf("expected a panic error, got %v", err)
+		}
+	}
+
+	// shops and goods depend on each other
+	factory = newFactory(map[string]any{
+		"GetGoodsTask": func(ctx context.Context, shops []Shop) ([]Goods, error) {
+			return nil, nil
+		},
+		"GetShopsTask": func(ctx context.Context, goods []Goods) ([]Shop, error) {
+			return nil, nil
+		},
+		"GoodsInShopsTask": groupGoodsInShops,
+	})
+	_, err := factory.CreateTaskDagflow(&GoodsInShopsCollection{})
+	var cycleErr *CycleError
+	if !errors.Is(err, ErrCycle) || !errors.As(err, &cycleErr) || len(cycleErr.TaskNames) != 2 {
+		t.Fatalf("expected a cycle error, got %v", err)
+	}
+	fmt.Printf("cycle detected as expected: %v\n", err)
+
+	// nobody produces shops
+	factory = newFactory(map[string]any{
+		"GetGoodsTask":     fetchGoods,
+		"GoodsInShopsTask": groupGoodsInShops,
+	})
+	_, err = factory.CreateTaskDagflow(&GoodsInShopsCollection{})
+	var unreachableErr *UnreachableError
+	if !errors.Is(err, ErrUnreachable) || !errors.As(err, &unreachableErr) ||
+		!reflect.DeepEqual(unreachableErr.OutputTypes, []reflect.Type{reflect.TypeOf(GoodsInShops{})}) {
+		t.Fatalf("expected an unreachable error, got %v", err)
+	}
+
+	// the create function is called at registration, then for every flow
+	factory = newFactory(map[string]any{"GetGoodsTask": fetchGoods, "GetShopsTask": fetchShops})
+	calls := 0
+	if err := factory.RegisterTask(func() (ITask[*GoodsInShopsCollection], error) {
+		if calls++; calls > 1 {
+			return nil, nil
+		}
+		return NewGoodsInShopsTask[*GoodsInShopsCollection]("GoodsInShopsTask", time.Second), nil
+	}); err != nil {
+		t.Fatalf("failed to register GoodsInShopsTask: %v", err)
+	}
+	_ = factory.CreateGraph()
+	_, err = factory.CreateTaskDagflow(&GoodsInShopsCollection{})
+	var nilErr *NilResultError
+	if !errors.Is(err, ErrNilResult) || !errors.As(err, &nilErr) || nilErr.TaskName != "GoodsInShopsTask" {
+		t.Fatalf("expected a nil result error, got %v", err)
+	}
+	// registration reports a nil task the same way, without its name
+	err = factory.RegisterTask(func() (ITask[*GoodsInShopsCollection], error) { return nil, nil })
+	if !errors.Is(err, ErrNilResult) || !errors.As(err, &nilErr) || nilErr.TaskName != "" {
+		t.Fatalf("expected a nil result error at registration, got %v", err)
+	}
+}
+
+func TestTaskContext(t *testing.T) {
+	var lock sync.Mutex
+	seen := make(map[string]TaskMetadata)
+	record := func(ctx context.Context) {
+		metadata, ok := TaskMetadataFromContext(ctx)
+		if !ok {
+			t.Errorf("task context has no metadata")
+		}
+		lock.Lock()
+		defer lock.Unlock()
+		seen[TaskNameFromContext(ctx)] = metadata
+	}
+
+	factory := NewFactoryWithConfig[*GoodsInShopsCollection](Config{Name: "goods_in_shops"})
+	for _, createFunc := range []TaskCreateFunc[*GoodsInShopsCollection]{
+		NewFuncTaskCreateFunc[*GoodsInShopsCollection]("GetGoodsTask", time.Second,
+			func(ctx context.Context) ([]Goods, error) {
+				record(ctx)
+				return fetchGoods(ctx)
+			}),
+		NewFuncTaskCreateFunc[*GoodsInShopsCollection]("GetShopsTask", time.Second,
+			func(ctx context.Context) ([]Shop, error) {
+				record(ctx)
+				return nil, errors.New("shops unavailable")
+			}),
+		NewFuncTaskCreateFunc[*GoodsInShopsCollection]("GoodsInShopsTask", time.Second, groupGoodsInShops),
+	} {
+		if err := factory.RegisterTask(createFunc); err != nil {
+			t.Fatalf("failed to register task: %v", err)
+		}
+	}
+	if err := factory.RegisterFallbackTask(NewFuncTaskCreateFunc[*GoodsInShopsCollection](
+		"CachedShopsTask", time.Second, func(ctx context.Context) ([]Shop, error) {
+			record(ctx)
+			return fetchShops(ctx)
+		})); err != nil {
+		t.Fatalf("failed to register fallback: %v", err)
+	}
+	_ = factory.CreateGraph()
+
+	if _, ok := TaskMetadataFromContext(context.Background()); ok || AttemptFromContext(context.Background()) != 0 {
+		t.Fatal("expected no metadata outside of a task")
+	}
+	for _, sequential := range []bool{false, true} {
+		clear(seen)
+		taskDagflow, err := factory.CreateTaskDagflow(&GoodsInShopsCollection{})
+		if err != nil {
+			t.Fatalf("failed to create TaskDagflow: %v", err)
+		}
+		ctx := WithRequestID(context.Background(), "req-1")
+		if sequential {
+			err = taskDagflow.ExecuteSequential(ctx, time.Second, nil)
+		} else {
+			err = taskDagflow.Execute(ctx, time.Second)
+		}
+		if err != nil {
+			t.Fatalf("task dagflow execution failed: %v", err)
+		}
+
+		runID := taskDagflow.Report().RunID
+		if runID == "" || len(seen) != 3 {
+			t.Fatalf("unexpected run %q with tasks %v", runID, seen)
+		}
+		for name, attempt := range map[string]int{"GetGoodsTask": 1, "GetShopsTask": 1, "CachedShopsTask": 2} {
+			expected := TaskMetadata{
+				FlowName: "goods_in_shops", TaskName: name, Attempt: attempt, RunID: runID, RequestID: "req-1",
+			}
+			if seen[name] != expected {
+				t.Errorf("unexpected metadata of %s: %+v", name, seen[name])
+			}
+		}
+	}
+
+	// the caller may choose the run id, e.g. to correlate with its own logs
+	taskDagflow, _ := factory.CreateTaskDagflow(&GoodsInShopsCollection{})
+	if err := taskDagflow.Execute(WithRunID(context.Background(), "run-1"), time.Second); err != nil {
+		t.Fatalf("task dagflow execution failed: %v", err)
+	}
+	if taskDagflow.Report().RunID != "run-1" || seen["GetGoodsTask"].RunID != "run-1" || seen["GetGoodsTask"].RequestID != "" {
+		t.Errorf("unexpected run id %q, metadata %+v", taskDagflow.Report().RunID, seen["GetGoodsTask"])
+	}
+}
+
+func TestResourceClass(t *testing.T) {
+	const class = "test-shops-rpc"
+	SetResourceLimit(class, 2)
+	defer SetResourceLimit(class, 0)
+
+	var running, maxRunning atomic.Int32
+	shops := func(ctx context.Context) ([]Shop, error) {
+		current := running.Add(1)
+		defer running.Add(-1)
+		for {
+			observed := maxRunning.Load()
+			if current <= observed || maxRunning.CompareAndSwap(observed, current) {
+				break
+			}
+		}
+		if err := sleepWithContext(ctx, 30*time.Millisecond); err != nil {
+			return nil, err
+		}
+		return fetchShops(ctx)
+	}
+	newFactory := func(name string, shopsTimeout time.Duration) *Factory[*GoodsInShopsCollection] {
+		factory := NewFactoryWithConfig[*GoodsInShopsCollection](Config{Name: name})
+		_ = factory.RegisterTask(NewFuncTaskCreateFunc[*GoodsInShopsCollection]("GetGoodsTask", time.Second, fetchGoods))
+		_ = factory.RegisterTask(NewFuncTaskCreateFunc[*GoodsInShopsCollection]("GetShopsTask", shopsTimeout, shops),
+			WithResourceClass[*GoodsInShopsCollection](class))
+		_ = factory.RegisterTask(NewFuncTaskCreateFunc[*GoodsInShopsCollection]("GoodsInShopsTask", time.Second, groupGoodsInShops))
+		_ = factory.CreateGraph()
+		return factory
+	}
+
+	// the limit is shared by flows of different factories
+	factories := []*Factory[*GoodsInShopsCollection]{newFactory("first", time.Second), newFactory("second", time.Second)}
+	if spec := factories[0].GraphSpec(); spec.Tasks[1].ResourceClass != class {
+		t.Fatalf("unexpected spec %+v", spec.Tasks[1])
+	}
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(factory *Factory[*GoodsInShopsCollection]) {
+			defer wg.Done()
+			taskDagflow, err := factory.CreateTaskDagflow(&GoodsInShopsCollection{})
+			if err == nil {
+				err = taskDagflow.Execute(context.Background(), 2*time.Second)
+			}
+			errs <- err
+		}(factories[i%2])
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("task dagflow execution failed: %v", err)
+		}
+	}
+	if maxRunning.Load() != 2 {
+		t.Fatalf("expected at most 2 shops tasks at once, got %d", maxRunning.Load())
+	}
+
+	// waiting for a slot counts against the task timeout
+	SetResourceLimit(class, 1)
+	limiter := resources.Limiter(class)
+	if err := limiter.Acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	taskDagflow, _ := newFactory("third", 50*time.Millisecond).CreateTaskDagflow(&GoodsInShopsCollection{})
+	if err := taskDagflow.Execute(context.Background(), time.Second); !errors.Is(err, ErrTaskTimeout) {
+		t.Fatalf("expected the task to time out waiting for its resource, got %v", err)
+	}
+
+	// raising the limit lets waiting tasks run
+	taskDagflow, _ = newFactory("fourth", time.Second).CreateTaskDagflow(&GoodsInShopsCollection{})
+	done := make(chan error)
+	go func() {
+		done <- taskDagflow.Execute(context.Background(), time.Second)
+	}()
+	for stats := GetResourceStats(); ; stats = GetResourceStats() {
+		if i := slices.IndexFunc(stats, func(s ResourceStats) bool { return s.Class == class }); i >= 0 && stats[i].Waiting == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	SetResourceLimit(class, 2)
+	if err := <-done; err != nil {
+		t.Fatalf("task dagflow execution failed: %v", err)
+	}
+	limiter.Release()
+	if stats := limiter.Stats(); stats.Running != 0 || stats.Waiting != 0 {
+		t.Fatalf("unexpected stats after runs %+v", stats)
+	}
+}
+
+type (
+	BatchItem   int
+	BatchSquare int
+)
+
+type batchCollection struct {
+	item   BatchItem
+	square BatchSquare
+}
+
+func (c *batchCollection) InputTypes() []reflect.Type {
+	return []reflect.Type{reflect.TypeOf(c.item)}
+}
+
+func (c *batchCollection) TargetTypes() []reflect.Type {
+	return []reflect.Type{reflect.TypeOf(c.square)}
+}
+
+func (c *batchCollection) GetItem() BatchItem {
+	return c.item
+}
+
+func (c *batchCollection) SetSquare(square BatchSquare) {
+	c.square = square
+}
+
+// newBatchSnapshot squares items after a delay decreasing with the item, multiples of 5 fail
+func newBatchSnapshot(t *testing.T) *Snapshot[*batchCollection] {
+	t.Helper()
+	factory := NewFactoryWithConfig[*batchCollection](Config{Name: "batch"})
+	if err := factory.RegisterTask(NewFuncTaskCreateFunc[*batchCollection]("SquareTask", time.Second,
+		func(ctx context.Context, item BatchItem) (BatchSquare, error) {
+			if item%5 == 0 {
+				return 0, fmt.Errorf("item %d rejected", item)
+			}
+			if err := sleepWithContext(ctx, time.Duration(20-item%20)*time.Millisecond); err != nil {
+				return 0, err
+			}
+			return BatchSquare(item * item), nil
+		})); err != nil {
+		t.Fatal(err)
+	}
+	if err := factory.CreateGraph(); err != nil {
+		t.Fatal(err)
+	}
+	snapshot, err := factory.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return snapshot
+}
+
+func TestExecuteBatch(t *testing.T) {
+	snapshot := newBatchSnapshot(t)
+	collections := make([]*batchCollection, 40)
+	for i := range collections {
+		collections[i] = &batchCollection{item: BatchItem(i + 1)}
+	}
+
+	results, stats := snapshot.ExecuteBatch(context.Background(), collections, BatchConfig{Workers: 8, Timeout: time.Second})
+	if len(results) != len(collections) {
+		t.Fatalf("expected %d results, got %d", len(collections), len(results))
+	}
+	for i, result := range results {
+		item := BatchItem(i + 1)
+		if result.Index != i || result.Collection != collections[i] || result.Report == nil {
+			t.Fatalf("unexpected result %d: %+v", i, result)
+		}
+		var taskErr *TaskError
+		switch {
+		case item%5 == 0 && (!errors.As(result.Err, &taskErr) || taskErr.TaskName != "SquareTask"):
+			t.Errorf("item %d: expected a SquareTask error, got %v", item, result.Err)
+		case item%5 != 0 && (result.Err != nil || result.Collection.square != BatchSquare(item*item)):
+			t.Errorf("item %d: unexpected result %v %d", item, result.Err, result.Collection.square)
+		}
+	}
+	if stats.Items != 40 || stats.Succeeded != 32 || stats.Failed != 8 || stats.FailedTasks["SquareTask"] != 8 ||
+		stats.MaxTimeCost < stats.AvgTimeCost || stats.ItemsPerSecond <= 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	// 40 items of up to 20ms on 8 workers
+	if stats.TimeCost > 400*time.Millisecond {
+		t.Errorf("expected items to run concurrently, batch took %v", stats.TimeCost)
+	}
+}
+
+func TestStreamBatch(t *testing.T) {
+	snapshot := newBatchSnapshot(t)
+	feed := func(items ...BatchItem) <-chan *batchCollection {
+		collections := make(chan *batchCollection, len(items))
+		for _, item := range items {
+			collections <- &batchCollection{item: item}
+		}
+		close(collections)
+		return collections
+	}
+
+	// unordered: short items overtake long ones
+	batch := snapshot.StreamBatch(context.Background(), feed(1, 2, 3, 19), BatchConfig{Workers: 4, Timeout: time.Second})
+	indexes := make([]int, 0)
+	for result := range batch.Results() {
+		indexes = append(indexes, result.Index)
+	}
+	if len(indexes) != 4 || indexes[0] != 3 {
+		t.Errorf("expected the shortest item first, got %v", indexes)
+	}
+	if stats := batch.Stats(); stats.Items != 4 || stats.Succeeded != 4 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	// ordered
+	batch = snapshot.StreamBatch(context.Background(), feed(1, 2, 3, 19), BatchConfig{Workers: 4, Timeout: time.Second, Ordered: true})
+	indexes = indexes[:0]
+	for result := range batch.Results() {
+		indexes = append(indexes, result.Index)
+	}
+	if !slices.Equal(indexes, []int{0, 1, 2, 3}) {
+		t.Errorf("expected results in input order, got %v", indexes)
+	}
+
+	// stop on error: the items after the failed one are not taken
+	batch = snapshot.StreamBatch(context.Background(), feed(1, 5, 2, 3, 4, 6, 7), BatchConfig{Workers: 1, Timeout: time.Second, StopOnError: true})
+	results := 0
+	for range batch.Results() {
+		results++
+	}
+	if stats := batch.Stats(); results != stats.Items || stats.Failed != 1 || stats.Items > 3 {
+		t.Errorf("expected the batch to stop after the failed item, got %+v", stats)
+	}
+}
+
+type (
+	QuoteBasePrice int
+	QuoteQuantity  int
+	QuoteSubtotal  int
+	QuoteDiscount  int
+	QuoteTotal     int
+)
+
+type quoteCollection struct {
+	basePrice QuoteBasePrice
+	quantity  QuoteQuantity
+	subtotal  QuoteSubtotal
+	discount  QuoteDiscount
+	total     QuoteTotal
+}
+
+func (c *quoteCollection) InputTypes() []reflect.Type {
+	return []reflect.Type{reflect.TypeOf(c.basePrice), reflect.TypeOf(c.quantity)}
+}
+
+func (c *quoteCollection) TargetTypes() []reflect.Type {
+	return []reflect.Type{reflect.TypeOf(c.total)}
+}
+
+func (c *quoteCollection) GetBasePrice() QuoteBasePrice { return c.basePrice }
+func (c *quoteCollection) GetQuantity() QuoteQuantity   { return c.quantity }
+func (c *quoteCollection) GetSubtotal() QuoteSubtotal   { return c.subtotal }
+func (c *quoteCollection) SetSubtotal(v QuoteSubtotal)  { c.subtotal = v }
+func (c *quoteCollection) GetDiscount() QuoteDiscount   { return c.discount }
+func (c *quoteCollection) SetDiscount(v QuoteDiscount)  { c.discount = v }
+func (c *quoteCollection) SetTotal(v QuoteTotal)        { c.total = v }
+
+// taskStatuses returns "name:status" of every task of the report, sorted
+func taskStatuses(report *RunReport) []string {
+	statuses := make([]string, 0, len(report.Tasks))
+	for _, task := range report.Tasks {
+		statuses = append(statuses, task.Name+":"+string(task.Status))
+	}
+	sort.Strings(statuses)
+	return statuses
+}
+
+func TestRecompute(t *testing.T) {
+	for _, sequential := range []bool{false, true} {
+		t.Run(fmt.Sprintf("sequential=%v", sequential), func(t *testing.T) {
+			var runs sync.Map
+			count := func(name string) {
+				counter, _ := runs.LoadOrStore(name, new(atomic.Int32))
+				counter.(*atomic.Int32).Add(1)
+			}
+			runCount := func(name string) int32 {
+				counter, ok := runs.Load(name)
+				if !ok {
+					return 0
+				}
+				return counter.(*atomic.Int32).Load()
+			}
+			failTotal := atomic.Bool{}
+			factory := NewFactoryWithConfig[*quoteCollection](Config{Name: "quote", Sequential: sequential})
+			for name, fn := range map[string]any{
+				"SubtotalTask": func(ctx context.Context, price QuoteBasePrice, quantity QuoteQuantity) (QuoteSubtotal, error) {
+					count("SubtotalTask")
+					return QuoteSubtotal(int(price) * int(quantity)), nil
+				},
+				"DiscountTask": func(ctx context.Context, quantity QuoteQuantity) (QuoteDiscount, error) {
+					count("DiscountTask")
+					return QuoteDiscount(int(quantity) / 10 * 5), nil
+				},
+				"TotalTask": func(ctx context.Context, subtotal QuoteSubtotal, discount QuoteDiscount) (QuoteTotal, error) {
+					count("TotalTask")
+					if failTotal.Load() {
+						return 0, errors.New("pricing service down")
+					}
+					return QuoteTotal(int(subtotal) - int(discount)), nil
+				},
+			} {
+				if err := factory.RegisterTask(NewFuncTaskCreateFunc[*quoteCollection](name, time.Second, fn)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := factory.CreateGraph(); err != nil {
+				t.Fatal(err)
+			}
+			collection := &quoteCollection{basePrice: 10, quantity: 20}
+			flow, err := factory.CreateTaskDagflow(collection)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// without a previous execution everything runs
+			if err := flow.Recompute(context.Background(), time.Second); err != nil || collection.total != 190 {
+				t.Fatalf("unexpected first run: %v %d", err, collection.total)
+			}
+
+			// the base price only changes the subtotal
+			collection.basePrice = 12
+			if err := flow.Recompute(context.Background(), time.Second, reflect.TypeOf(QuoteBasePrice(0))); err != nil {
+				t.Fatal(err)
+			}
+			if collection.total != 230 || runCount("SubtotalTask") != 2 || runCount("DiscountTask") != 1 || runCount("TotalTask") != 2 {
+				t.Errorf("unexpected recompute: total %d", collection.total)
+			}
+			if got, want := taskStatuses(flow.Report()), []string{"DiscountTask:reused", "SubtotalTask:success", "TotalTask:success"}; !slices.Equal(got, want) {
+				t.Errorf("expected statuses %v, got %v", want, got)
+			}
+
+			// an overridden task output is kept, its producer does not run
+			collection.discount = 100
+			if err := flow.Recompute(context.Background(), time.Second, reflect.TypeOf(QuoteDiscount(0))); err != nil {
+				t.Fatal(err)
+			}
+			if collection.total != 140 || runCount("DiscountTask") != 1 || runCount("TotalTask") != 3 {
+				t.Errorf("unexpected override: total %d", collection.total)
+			}
+
+			// failed tasks of the last execution run again
+			failTotal.Store(true)
+			collection.quantity = 30
+			if err := flow.Recompute(context.Background(), time.Second, reflect.TypeOf(QuoteQuantity(0))); err == nil {
+				t.Fatal("expected the total task to fail")
+			}
+			failTotal.Store(false)
+			if err := flow.Recompute(context.Background(), time.Second); err != nil || collection.total != 345 {
+				t.Fatalf("unexpected retry: %v %d", err, collection.total)
+			}
+			if got, want := taskStatuses(flow.Report()), []string{"DiscountTask:reused", "SubtotalTask:reused", "TotalTask:success"}; !slices.Equal(got, want) {
+				t.Errorf("expected statuses %v, got %v", want, got)
+			}
+			// reused tasks are kept by the next recompute as well
+			if err := flow.Recompute(context.Background(), time.Second); err != nil || runCount("DiscountTask") != 2 || runCount("SubtotalTask") != 3 {
+				t.Errorf("unexpected second retry: %v", err)
+			}
+
+			// an output overridden before any execution is kept as well
+			overridden := &quoteCollection{basePrice: 10, quantity: 20, subtotal: 300}
+			fresh, err := factory.CreateTaskDagflow(overridden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := fresh.Recompute(context.Background(), time.Second, reflect.TypeOf(QuoteSubtotal(0))); err != nil {
+				t.Fatal(err)
+			}
+			if got, want := taskStatuses(fresh.Report()), []string{"DiscountTask:success", "SubtotalTask:reused", "TotalTask:success"}; !slices.Equal(got, want) {
+				t.Errorf("expected statuses %v, got %v", want, got)
+			}
+			if overridden.total != 290 || runCount("SubtotalTask") != 3 || producerOf(fresh.Report(), "SubtotalTask") != "SubtotalTask" {
+				t.Errorf("unexpected overridden subtotal: total %d", overridden.total)
+			}
+		})
+	}
+}
+
+func TestDiffGraphSpecs(t *testing.T) {
+	before := GraphSpec{Name: "page", Version: 3, Tasks: []TaskSpec{
+		{Name: "ProfileTask", InputTypes: []string{"User"}, OutputType: "Profile", Timeout: 500 * time.Millisecond},
+		{Name: "FeedTask", InputTypes: []string{"User"}, OutputType: "Feed", Timeout: time.Second},
+		{Name: "PageTask", InputTypes: []string{"Feed", "Profile"}, OutputType: "Page", Timeout: time.Second},
+		{Name: "AdsTask", InputTypes: []string{"User"}, OutputType: "Ads", Timeout: time.Second},
+	}}
+	after := GraphSpec{Name: "page", Version: 4, Tasks: []TaskSpec{
+		{Name: "ProfileTask", InputTypes: []string{"Region", "User"}, OutputType: "Profile", Timeout: time.Second,
+			Fallbacks: []TaskSpec{{Name: "CachedProfileTask", InputTypes: []string{"User"}, OutputType: "Profile", Timeout: 50 * time.Millisecond}}},
+		{Name: "FeedTask", InputTypes: []string{"User"}, OutputType: "Feed", Timeout: time.Second},
+		{Name: "PageTask", InputTypes: []string{"Feed", "Profile"}, OutputType: "Page", Timeout: time.Second},
+		{Name: "RegionTask", InputTypes: []string{"User"}, OutputType: "Region", Timeout: 100 * time.Millisecond},
+		{Name: "StatsTask", InputTypes: []string{"Feed"}, OutputType: "Stats", Timeout: time.Second, ResourceClass: "mysql"},
+	}}
+
+	diff := DiffGraphSpecs(before, after)
+	want := `graph diff: page (v3) -> page (v4)
++ task RegionTask(User) -> Region, timeout 100ms
++ task StatsTask(Feed) -> Stats, timeout 1s
+- task AdsTask(User) -> Ads, timeout 1s
+~ task ProfileTask
+    inputs: +Region
+    timeout: 500ms -> 1s
+    fallbacks: [] -> [CachedProfileTask(User) 50ms]
+targets with a changed producing chain:
+  Ads: AdsTask
+  Page: ProfileTask, RegionTask
+  Stats: StatsTask
+`
+	if got := diff.String(); got != want {
+		t.Errorf("unexpected diff:\n%s\nexpected:\n%s", got, want)
+	}
+	if diff.Empty() || len(diff.Changed) != 1 || diff.Changed[0].Old.Timeout != 500*time.Millisecond {
+		t.Errorf("unexpected diff %+v", diff)
+	}
+
+	if diff := DiffGraphSpecs(after, after); !diff.Empty() || len(diff.Targets) != 0 ||
+		diff.String() != "graph diff: page (v4) -> page (v4)\nno changes\n" {
+		t.Errorf("expected no changes, got %s", diff)
+	}
+
+	// factories registering the same tasks don't differ
+	newFactory := func(timeout time.Duration) *Factory[*GoodsInShopsCollection] {
+		factory := NewFactory[*GoodsInShopsCollection]()
+		for _, createFunc := range []TaskCreateFunc[*GoodsInShopsCollection]{
+			NewGetGoodsTaskCreateFunc[*GoodsInShopsCollection]("GetGoodsTask", timeout),
+			NewGetShopsTaskCreateFunc[*GoodsInShopsCollection]("GetShopsTask", 500*time.Millisecond),
+			NewGoodsInShopsTaskCreateFunc[*GoodsInShopsCollection]("GoodsInShopsTask", 500*time.Millisecond),
+		} {
+			if err := factory.RegisterTask(createFunc); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return factory
+	}
+	if diff := DiffFactories(newFactory(time.Second), newFactory(time.Second)); !diff.Empty() {
+		t.Errorf("expected no changes, got %s", diff)
+	}
+	diff = DiffFactories(newFactory(time.Second), newFactory(2*time.Second))
+	if len(diff.Changed) != 1 || diff.Changed[0].Name != "GetGoodsTask" ||
+		len(diff.Targets) != 1 || diff.Targets[0].Tasks[0] != "GetGoodsTask" {
+		t.Errorf("unexpected diff %s", diff)
+	}
+}
+
+func TestTypedTask(t *testing.T) {
+	factory := NewFactory[*quoteCollection]()
+	tasks := []*TypedTask[*quoteCollection]{
+		NewTask2("SubtotalTask", time.Second,
+			(*quoteCollection).GetBasePrice, (*quoteCollection).GetQuantity, (*quoteCollection).SetSubtotal,
+			func(ctx context.Context, price QuoteBasePrice, quantity QuoteQuantity) (QuoteSubtotal, error) {
+				return QuoteSubtotal(int(price) * int(quantity)), nil
+			}),
+		NewTask1("DiscountTask", time.Second,
+			(*quoteCollection).GetQuantity, (*quoteCollection).SetDiscount,
+			func(ctx context.Context, quantity QuoteQuantity) (QuoteDiscount, error) {
+				return QuoteDiscount(int(quantity) / 10 * 5), nil
+			}),
+		NewTask2("TotalTask", time.Second,
+			(*quoteCollection).GetSubtotal, (*quoteCollection).GetDiscount, (*quoteCollection).SetTotal,
+			func(ctx context.Context, subtotal QuoteSubtotal, discount QuoteDiscount) (QuoteTotal, error) {
+				return QuoteTotal(int(subtotal) - int(discount)), nil
+			}),
+	}
+	for _, task := range tasks {
+		if err := factory.RegisterTask(task.CreateFunc()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := tasks[2].InputTypes(), []reflect.Type{reflect.TypeOf(QuoteSubtotal(0)), reflect.TypeOf(QuoteDiscount(0))}; !slices.Equal(got, want) {
+		t.Errorf("expected input types %v, got %v", want, got)
+	}
+	if err := factory.CreateGraph(); err != nil {
+		t.Fatal(err)
+	}
+	collection := &quoteCollection{basePrice: 10, quantity: 20}
+	flow, err := factory.CreateTaskDagflow(collection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := flow.Execute(context.Background(), time.Second); err != nil || collection.total != 190 {
+		t.Fatalf("unexpected run: %v %d", err, collection.total)
+	}
+
+	// source tasks have no inputs
+	source := NewTask0("GetGoodsTask", time.Second, (*GoodsInShopsCollection).SetGoods,
+		func(ctx context.Context) ([]Goods, error) { return GoodsData, nil })
+	if got := source.InputTypes(); len(got) != 1 || got[0] != nil || source.OutputType() != reflect.TypeOf(GoodsData) {
+		t.Errorf("unexpected source task types %v -> %v", got, source.OutputType())
+	}
+
+	// mistakes the compiler can't catch fail at registration
+	loop := NewTask1("LoopTask", time.Second, (*quoteCollection).GetSubtotal, (*quoteCollection).SetSubtotal,
+		func(ctx context.Context, subtotal QuoteSubtotal) (QuoteSubtotal, error) { return subtotal, nil })
+	if err := NewTaskSet[*quoteCollection]().RegisterTask(loop.CreateFunc()); err == nil {
+		t.Error("expected an error for a task consuming its own output")
+	}
+	twice := NewTask2("TwiceTask", time.Second, (*quoteCollection).GetQuantity, (*quoteCollection).GetQuantity, (*quoteCollection).SetDiscount,
+		func(ctx context.Context, a QuoteQuantity, b QuoteQuantity) (QuoteDiscount, error) { return 0, nil })
+	if err := NewTaskSet[*quoteCollection]().RegisterTask(twice.CreateFunc()); err == nil {
+		t.Error("expected an error for an input declared twice")
+	}
+}
+
+type (
+	OrderReservation string
+	OrderPayment     string
+	OrderShipment    string
+)
+
+type orderCollection struct {
+	reservation OrderReservation
+	payment     OrderPayment
+	shipment    OrderShipment
+}
+
+func (c *orderCollection) InputTypes() []reflect.Type {
+	return []reflect.Type{nil}
+}
+
+func (c *orderCollection) TargetTypes() []reflect.Type {
+	return []reflect.Type{reflect.TypeOf(c.shipment)}
+}
+
+func (c *orderCollection) GetReservation() OrderReservation  { return c.reservation }
+func (c *orderCollection) SetReservation(v OrderReservation) { c.reservation = v }
+func (c *orderCollection) GetPayment() OrderPayment          { return c.payment }
+func (c *orderCollection) SetPayment(v OrderPayment)         { c.payment = v }
+func (c *orderCollection) SetShipment(v OrderShipment)       { c.shipment = v }
+
+func TestCompensation(t *testing.T) {
+	newOrderFactory := func(sequential bool, shipErr error, refundErr error) (*Factory[*orderCollection], *[]string) {
+		var lock sync.Mutex
+		compensated := make([]string, 0)
+		record := func(ctx context.Context, entry string) {
+			lock.Lock()
+			defer lock.Unlock()
+			if ctx.Err() != nil || TaskNameFromContext(ctx) == "" {
+				entry += " without task ctx"
+			}
+			compensated = append(compensated, entry)
+		}
+		factory := NewFactoryWithConfig[*orderCollection](Config{Name: "order", Sequential: sequential})
+		registrations := []struct {
+			task   *TypedTask[*orderCollection]
+			option TaskOption[*orderCollection]
+		}{
+			{NewTask0("ReserveTask", time.Second, (*orderCollection).SetReservation,
+				func(ctx context.Context) (OrderReservation, error) { return "r-1", nil }),
+				WithCompensation(func(ctx context.Context, c *orderCollection) error {
+					record(ctx, "release "+string(c.reservation))
+					return nil
+				})},
+			{NewTask1("ChargeTask", time.Second, (*orderCollection).GetReservation, (*orderCollection).SetPayment,
+				func(ctx context.Context, reservation OrderReservation) (OrderPayment, error) { return "p-1", nil }),
+				WithCompensation(func(ctx context.Context, c *orderCollection) error {
+					record(ctx, "refund "+string(c.payment))
+					return refundErr
+				})},
+			{NewTask1("ShipTask", time.Second, (*orderCollection).GetPayment, (*orderCollection).SetShipment,
+				func(ctx context.Context, payment OrderPayment) (OrderShipment, error) { return "s-1", shipErr }),
+				WithCompensation(func(ctx context.Context, c *orderCollection) error {
+					record(ctx, "cancel "+string(c.shipment))
+					return nil
+				})},
+		}
+		for _, registration := range registrations {
+			if err := factory.RegisterTask(registration.task.CreateFunc(), registration.option); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := factory.CreateGraph(); err != nil {
+			t.Fatal(err)
+		}
+		return factory, &compensated
+	}
+	run := func(factory *Factory[*orderCollection]) (*RunReport, error) {
+		flow, err := factory.CreateTaskDagflow(&orderCollection{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = flow.Execute(context.Background(), time.Second)
+		return flow.Report(), err
+	}
+
+	for _, sequential := range []bool{false, true} {
+		// successful runs are not compensated
+		factory, compensated := newOrderFactory(sequential, nil, nil)
+		if _, err := run(factory); err != nil || len(*compensated) != 0 {
+			t.Fatalf("unexpected run: %v %v", err, *compensated)
+		}
+		if spec := factory.GraphSpec(); !spec.Tasks[0].Compensation {
+			t.Errorf("expected the spec to declare the compensation")
+		}
+
+		// succeeded tasks are compensated in reverse order, the failed task is not
+		factory, compensated = newOrderFactory(sequential, errors.New("no carrier"), nil)
+		report, err := run(factory)
+		var taskErr *TaskError
+		if !errors.As(err, &taskErr) || taskErr.TaskName != "ShipTask" || errors.Is(err, ErrCompensation) {
+			t.Errorf("expected the ShipTask error, got %v", err)
+		}
+		if want := []string{"refund p-1", "release r-1"}; !slices.Equal(*compensated, want) {
+			t.Errorf("expected compensations %v, got %v", want, *compensated)
+		}
+		for _, task := range report.Tasks {
+			if task.Compensated != (task.Name != "ShipTask") {
+				t.Errorf("unexpected compensation of %s: %+v", task.Name, task)
+			}
+		}
+
+		// failed compensations are joined to the error, the others still run
+		factory, compensated = newOrderFactory(sequential, errors.New("no carrier"), errors.New("bank down"))
+		report, err = run(factory)
+		var compensationErr *CompensationError
+		if !errors.As(err, &taskErr) || !errors.As(err, &compensationErr) || compensationErr.TaskName != "ChargeTask" {
+			t.Errorf("expected task and compensation errors, got %v", err)
+		}
+		if len(*compensated) != 2 || producerOf(report, "ChargeTask") == "" {
+			t.Errorf("expected both compensations, got %v", *compensated)
+		}
+		for _, task := range report.Tasks {
+			if task.Name == "ChargeTask" && task.CompensationError != "bank down" {
+				t.Errorf("expected the compensation error in the report, got %+v", task)
+			}
+		}
+	}
+}
+
+// quotePricing is a dependency of the quote tasks, tests provide fakes of it
+type quotePricing interface {
+	DiscountRate(quantity QuoteQuantity) int
+}
+
+type flatPricing int
+
+func (p flatPricing) DiscountRate(quantity QuoteQuantity) int { return int(p) }
+
+func newDiscountTask(deps *Deps) (ITask[*quoteCollection], error) {
+	pricing, err := Resolve[quotePricing](deps)
+	if err != nil {
+		return nil, err
+	}
+	return NewTask2("DiscountTask", time.Second,
+		(*quoteCollection).GetSubtotal, (*quoteCollection).GetQuantity, (*quoteCollection).SetDiscount,
+		func(ctx context.Context, subtotal QuoteSubtotal, quantity QuoteQuantity) (QuoteDiscount, error) {
+			return QuoteDiscount(int(subtotal) * pricing.DiscountRate(quantity) / 100), nil
+		}), nil
+}
+
+func TestRegisterConstructor(t *testing.T) {
+	subtotal := NewTask2("SubtotalTask", time.Second,
+		(*quoteCollection).GetBasePrice, (*quoteCollection).GetQuantity, (*quoteCollection).SetSubtotal,
+		func(ctx context.Context, price QuoteBasePrice, quantity QuoteQuantity) (QuoteSubtotal, error) {
+			return QuoteSubtotal(int(price) * int(quantity)), nil
+		})
+	total := NewTask2("TotalTask", time.Second,
+		(*quoteCollection).GetSubtotal, (*quoteCollection).GetDiscount, (*quoteCollection).SetTotal,
+		func(ctx context.Context, subtotal QuoteSubtotal, discount QuoteDiscount) (QuoteTotal, error) {
+			return QuoteTotal(int(subtotal) - int(discount)), nil
+		})
+	newFactory := func(deps *Deps) (*Factory[*quoteCollection], error) {
+		factory := NewFactoryWithConfig[*quoteCollection](Config{Deps: deps})
+		for _, err := range []error{
+			factory.RegisterTask(subtotal.CreateFunc()),
+			factory.RegisterConstructor(newDiscountTask),
+			factory.RegisterTask(total.CreateFunc()),
+			factory.CreateGraph(),
+		} {
+			if err != nil {
+				return nil, err
+			}
+		}
+		return factory, nil
+	}
+	quote := func(factory *Factory[*quoteCollection]) QuoteTotal {
+		collection := &quoteCollection{basePrice: 10, quantity: 20}
+		flow, err := factory.CreateTaskDagflow(collection)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := flow.Execute(context.Background(), time.Second); err != nil {
+			t.Fatal(err)
+		}
+		return collection.total
+	}
+
+	// a missing dependency fails at registration, not in the first flow
+	var missing *MissingDependencyError
+	if _, err := newFactory(nil); !errors.Is(err, ErrMissingDependency) || !errors.As(err, &missing) ||
+		missing.Type != reflect.TypeFor[quotePricing]() {
+		t.Fatalf("expected a missing quotePricing, got %v", err)
+	}
+
+	deps := NewDeps()
+	Provide[quotePricing](deps, flatPricing(10))
+	factory, err := newFactory(deps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := quote(factory); got != 180 {
+		t.Errorf("expected total 180, got %d", got)
+	}
+	if types := factory.Deps().Types(); len(types) != 1 || types[0] != reflect.TypeFor[quotePricing]() {
+		t.Errorf("unexpected dependency types %v", types)
+	}
+
+	// tests swap fakes in a copy, the original container is unchanged
+	fakes := deps.Clone()
+	Provide[quotePricing](fakes, flatPricing(50))
+	fakeFactory, err := newFactory(fakes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := quote(fakeFactory); got != 100 {
+		t.Errorf("expected total 100 with the fake pricing, got %d", got)
+	}
+	if got := quote(factory); got != 180 {
+		t.Errorf("expected total 180 with the original pricing, got %d", got)
+	}
+
+	// bound constructors also register into task sets
+	tasks := NewTaskSet[*quoteCollection]()
+	if err := tasks.RegisterTask(TaskConstructor[*quoteCollection](newDiscountTask).Bind(NewDeps())); !errors.Is(err, ErrMissingDependency) {
+		t.Errorf("expected ErrMissingDependency, got %v", err)
+	}
+}
+
+func TestRecomputeAfterCompensation(t *testing.T) {
+	for _, sequential := range []bool{false, true} {
+		t.Run(fmt.Sprintf("sequential=%v", sequential), func(t *testing.T) {
+			var reservations, shipments atomic.Int32
+			released := make([]OrderReservation, 0)
+			factory := NewFactoryWithConfig[*orderCollection](Config{Sequential: sequential})
+			reserve := NewTask0("ReserveTask", time.Second, (*orderCollection).SetReservation,
+				func(ctx context.Context) (OrderReservation, error) {
+					return OrderReservation(fmt.Sprintf("r-%d", reservations.Add(1))), nil
+				})
+			ship := NewTask1("ShipTask", time.Second, (*orderCollection).GetReservation, (*orderCollection).SetShipment,
+				func(ctx context.Context, reservation OrderReservation) (OrderShipment, error) {
+					if shipments.Add(1) == 1 {
+						return "", errors.New("no carrier")
+					}
+					return OrderShipment("ship " + reservation), nil
+				})
+			for _, err := range []error{
+				factory.RegisterTask(reserve.CreateFunc(), WithCompensation(func(ctx context.Context, c *orderCollection) error {
+					// compensations run one at a time
+					released = append(released, c.reservation)
+					return nil
+				})),
+				factory.RegisterTask(ship.CreateFunc()),
+				factory.CreateGraph(),
+			} {
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			collection := &orderCollection{}
+			flow, err := factory.CreateTaskDagflow(collection)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := flow.Execute(context.Background(), time.Second); err == nil {
+				t.Fatal("expected the first shipment to fail")
+			}
+
+			// the released reservation is not reused by the resumed run
+			if err := flow.Recompute(context.Background(), time.Second); err != nil {
+				t.Fatal(err)
+			}
+			if want := []string{"ReserveTask:success", "ShipTask:success"}; !slices.Equal(taskStatuses(flow.Report()), want) {
+				t.Errorf("expected %v, got %v", want, taskStatuses(flow.Report()))
+			}
+			if collection.shipment != "ship r-2" || !slices.Equal(released, []OrderReservation{"r-1"}) {
+				t.Errorf("unexpected shipment %q, released %v", collection.shipment, released)
+			}
+		})
+	}
+}
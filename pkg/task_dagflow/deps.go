@@ -0,0 +1,84 @@
+package task_dagflow
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// Deps is a typed dependency container: DB handles, HTTP clients, config, ... keyed by their type.
+// A Factory holds one, see Config.Deps, and passes it to TaskConstructor functions. Deps is concurrent-safe.
+type Deps struct {
+	lock   sync.RWMutex
+	values map[reflect.Type]any
+}
+
+func NewDeps() *Deps {
+	return &Deps{values: make(map[reflect.Type]any)}
+}
+
+// Provide stores value under the type T, replacing a value of the same type.
+// Give T explicitly to provide an implementation under an interface, e.g. Provide[HTTPDoer](deps, client).
+func Provide[T any](deps *Deps, value T) {
+	deps.lock.Lock()
+	defer deps.lock.Unlock()
+	deps.values[reflect.TypeFor[T]()] = value
+}
+
+// Resolve returns the value provided under the type T, a *MissingDependencyError if there is none
+func Resolve[T any](deps *Deps) (T, error) {
+	deps.lock.RLock()
+	defer deps.lock.RUnlock()
+	value, ok := deps.values[reflect.TypeFor[T]()]
+	if !ok {
+		var zero T
+		return zero, &MissingDependencyError{Type: reflect.TypeFor[T]()}
+	}
+	// a nil interface value was provided
+	typed, _ := value.(T)
+	return typed, nil
+}
+
+// Types returns the provided types, sorted by name
+func (d *Deps) Types() []reflect.Type {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	types := make([]reflect.Type, 0, len(d.values))
+	for t := range d.values {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		return types[i].String() < types[j].String()
+	})
+	return types
+}
+
+// Clone returns a copy of the container, e.g. for a test to replace some dependencies with fakes
+func (d *Deps) Clone() *Deps {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	cloned := NewDeps()
+	for t, value := range d.values {
+		cloned.values[t] = value
+	}
+	return cloned
+}
+
+// TaskConstructor creates a task from the dependencies it resolves, it is the TaskCreateFunc
+// of tasks depending on clients or config instead of capturing them in globals
+type TaskConstructor[CT ICollection] func(deps *Deps) (ITask[CT], error)
+
+// Bind returns a TaskCreateFunc calling the constructor with deps, for TaskSet registrations,
+// variants and fallbacks. The constructor runs at registration, so a missing dependency fails there,
+// and again for every flow unless the task is an IStatelessTask, e.g. built by NewTask0..4:
+// dependencies replaced afterwards are used by the next flows of stateful tasks only.
+func (c TaskConstructor[CT]) Bind(deps *Deps) TaskCreateFunc[CT] {
+	return func() (ITask[CT], error) {
+		task, err := c(deps)
+		if err != nil {
+			return nil, fmt.Errorf("construct task: %w", err)
+		}
+		return task, nil
+	}
+}
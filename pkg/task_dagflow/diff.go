@@ -0,0 +1,276 @@
+package task_dagflow
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// GraphDiff is the difference between two graph specs, see DiffGraphSpecs
+type GraphDiff struct {
+	OldName    string `json:"old_name"`
+	OldVersion uint64 `json:"old_version,omitempty"`
+	NewName    string `json:"new_name"`
+	NewVersion uint64 `json:"new_version,omitempty"`
+	// Added, Removed and Changed tasks are sorted by name
+	Added   []TaskSpec   `json:"added,omitempty"`
+	Removed []TaskSpec   `json:"removed,omitempty"`
+	Changed []TaskChange `json:"changed,omitempty"`
+	// Targets lists output types no task consumes, the usual targets of collections,
+	// whose producing chain has an added, removed or changed task
+	Targets []TargetChange `json:"targets,omitempty"`
+}
+
+// TaskChange describes a task present in both specs whose spec changed
+type TaskChange struct {
+	Name string   `json:"name"`
+	Old  TaskSpec `json:"old"`
+	New  TaskSpec `json:"new"`
+	// Changes are human readable, e.g. "timeout: 500ms -> 1s"
+	Changes []string `json:"changes"`
+}
+
+// TargetChange is a target whose producing chain changed, Tasks are the changed tasks of the chain
+type TargetChange struct {
+	OutputType string   `json:"output_type"`
+	Tasks      []string `json:"tasks"`
+}
+
+// DiffFactories compares the registered tasks of two factories, e.g. before and after a change of registrations
+func DiffFactories(from IFactory, to IFactory) GraphDiff {
+	return DiffGraphSpecs(from.GraphSpec(), to.GraphSpec())
+}
+
+// DiffGraphSpecs compares two graph specs, e.g. specs exported as json by two builds.
+// Tasks are matched by name, or by name and output type if a spec has several tasks of the same name.
+func DiffGraphSpecs(from GraphSpec, to GraphSpec) GraphDiff {
+	diff := GraphDiff{OldName: from.Name, OldVersion: from.Version, NewName: to.Name, NewVersion: to.Version}
+	oldTasks, newTasks := specKeys(from.Tasks), specKeys(to.Tasks)
+	changedTasks := make(map[string]bool)
+	for key, oldTask := range oldTasks {
+		newTask, ok := newTasks[key]
+		if !ok {
+			diff.Removed = append(diff.Removed, oldTask)
+			changedTasks[oldTask.Name] = true
+			continue
+		}
+		if changes := taskChanges(oldTask, newTask); len(changes) > 0 {
+			diff.Changed = append(diff.Changed, TaskChange{Name: newTask.Name, Old: oldTask, New: newTask, Changes: changes})
+			changedTasks[newTask.Name] = true
+		}
+	}
+	for key, newTask := range newTasks {
+		if _, ok := oldTasks[key]; !ok {
+			diff.Added = append(diff.Added, newTask)
+			changedTasks[newTask.Name] = true
+		}
+	}
+	sortTaskSpecs(diff.Added)
+	sortTaskSpecs(diff.Removed)
+	sort.Slice(diff.Changed, func(i, j int) bool {
+		return diff.Changed[i].Name < diff.Changed[j].Name
+	})
+
+	if len(changedTasks) == 0 {
+		return diff
+	}
+	oldChains, newChains := newSpecChains(from), newSpecChains(to)
+	targets := append(oldChains.Targets(), newChains.Targets()...)
+	slices.Sort(targets)
+	for _, target := range slices.Compact(targets) {
+		tasks := make([]string, 0)
+		for _, chains := range []specChains{oldChains, newChains} {
+			for _, task := range chains.Chain(target) {
+				if changedTasks[task] {
+					tasks = append(tasks, task)
+				}
+			}
+		}
+		if len(tasks) > 0 {
+			slices.Sort(tasks)
+			diff.Targets = append(diff.Targets, TargetChange{OutputType: target, Tasks: slices.Compact(tasks)})
+		}
+	}
+	return diff
+}
+
+// Empty reports whether the specs have the same tasks
+func (d GraphDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// String renders the diff as text for terminals and PR comments:
+// "+" for added tasks, "-" for removed tasks, "~" for changed tasks
+func (d GraphDiff) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "graph diff: %s -> %s\n", specTitle(d.OldName, d.OldVersion), specTitle(d.NewName, d.NewVersion))
+	if d.Empty() {
+		b.WriteString("no changes\n")
+		return b.String()
+	}
+	for _, task := range d.Added {
+		fmt.Fprintf(&b, "+ task %s\n", taskSignature(task))
+	}
+	for _, task := range d.Removed {
+		fmt.Fprintf(&b, "- task %s\n", taskSignature(task))
+	}
+	for _, change := range d.Changed {
+		fmt.Fprintf(&b, "~ task %s\n", change.Name)
+		for _, line := range change.Changes {
+			fmt.Fprintf(&b, "    %s\n", line)
+		}
+	}
+	if len(d.Targets) > 0 {
+		b.WriteString("targets with a changed producing chain:\n")
+		for _, target := range d.Targets {
+			fmt.Fprintf(&b, "  %s: %s\n", target.OutputType, strings.Join(target.Tasks, ", "))
+		}
+	}
+	return b.String()
+}
+
+func specTitle(name string, version uint64) string {
+	if version == 0 {
+		return name
+	}
+	return fmt.Sprintf("%s (v%d)", name, version)
+}
+
+// taskSignature renders a task like "PageTask(Profile, User) -> Page, timeout 1s"
+func taskSignature(task TaskSpec) string {
+	return fmt.Sprintf("%s(%s) -> %s, timeout %s", task.Name, strings.Join(task.InputTypes, ", "), task.OutputType, task.Timeout)
+}
+
+func specKeys(tasks []TaskSpec) map[string]TaskSpec {
+	counts := make(map[string]int, len(tasks))
+	for _, task := range tasks {
+		counts[task.Name]++
+	}
+	keys := make(map[string]TaskSpec, len(tasks))
+	for _, task := range tasks {
+		key := task.Name
+		if counts[task.Name] > 1 {
+			key += " -> " + task.OutputType
+		}
+		keys[key] = task
+	}
+	return keys
+}
+
+func sortTaskSpecs(tasks []TaskSpec) {
+	sort.Slice(tasks, func(i, j int) bool {
+		if tasks[i].Name != tasks[j].Name {
+			return tasks[i].Name < tasks[j].Name
+		}
+		return tasks[i].OutputType < tasks[j].OutputType
+	})
+}
+
+func taskChanges(from TaskSpec, to TaskSpec) []string {
+	changes := make([]string, 0)
+	if added, removed := diffStrings(from.InputTypes, to.InputTypes); len(added)+len(removed) > 0 {
+		parts := make([]string, 0, len(added)+len(removed))
+		for _, input := range added {
+			parts = append(parts, "+"+input)
+		}
+		for _, input := range removed {
+			parts = append(parts, "-"+input)
+		}
+		changes = append(changes, "inputs: "+strings.Join(parts, " "))
+	}
+	if from.OutputType != to.OutputType {
+		changes = append(changes, fmt.Sprintf("output: %s -> %s", from.OutputType, to.OutputType))
+	}
+	if from.Timeout != to.Timeout {
+		changes = append(changes, fmt.Sprintf("timeout: %s -> %s", from.Timeout, to.Timeout))
+	}
+	if from.Variant != to.Variant {
+		changes = append(changes, fmt.Sprintf("variant: %t -> %t", from.Variant, to.Variant))
+	}
+	if from.ResourceClass != to.ResourceClass {
+		changes = append(changes, fmt.Sprintf("resource class: %q -> %q", from.ResourceClass, to.ResourceClass))
+	}
+	if from.Compensation != to.Compensation {
+		changes = append(changes, fmt.Sprintf("compensation: %t -> %t", from.Compensation, to.Compensation))
+	}
+	if !reflect.DeepEqual(from.Fallbacks, to.Fallbacks) {
+		changes = append(changes, fmt.Sprintf("fallbacks: %s -> %s", fallbackList(from.Fallbacks), fallbackList(to.Fallbacks)))
+	}
+	return changes
+}
+
+// diffStrings returns the strings only in to and the strings only in from
+func diffStrings(from []string, to []string) (added []string, removed []string) {
+	for _, s := range to {
+		if !slices.Contains(from, s) {
+			added = append(added, s)
+		}
+	}
+	for _, s := range from {
+		if !slices.Contains(to, s) {
+			removed = append(removed, s)
+		}
+	}
+	return added, removed
+}
+
+func fallbackList(fallbacks []TaskSpec) string {
+	signatures := make([]string, 0, len(fallbacks))
+	for _, fallback := range fallbacks {
+		signatures = append(signatures, fmt.Sprintf("%s(%s) %s", fallback.Name, strings.Join(fallback.InputTypes, ", "), fallback.Timeout))
+	}
+	return "[" + strings.Join(signatures, "; ") + "]"
+}
+
+// specChains finds the tasks producing a type in a spec, directly or through their inputs
+type specChains struct {
+	producers map[string][]TaskSpec
+	consumed  map[string]bool
+}
+
+func newSpecChains(spec GraphSpec) specChains {
+	chains := specChains{producers: make(map[string][]TaskSpec), consumed: make(map[string]bool)}
+	for _, task := range spec.Tasks {
+		chains.producers[task.OutputType] = append(chains.producers[task.OutputType], task)
+		for _, input := range task.InputTypes {
+			chains.consumed[input] = true
+		}
+	}
+	return chains
+}
+
+// Targets returns the output types no task consumes
+func (c specChains) Targets() []string {
+	targets := make([]string, 0)
+	for outputType := range c.producers {
+		if !c.consumed[outputType] {
+			targets = append(targets, outputType)
+		}
+	}
+	return targets
+}
+
+// Chain returns the names of the tasks outputType depends on, including fallbacks and all variants
+func (c specChains) Chain(outputType string) []string {
+	names := make([]string, 0)
+	visited := map[string]bool{outputType: true}
+	queue := []string{outputType}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, task := range c.producers[current] {
+			for _, producer := range append([]TaskSpec{task}, task.Fallbacks...) {
+				names = append(names, producer.Name)
+				for _, input := range producer.InputTypes {
+					if !visited[input] {
+						visited[input] = true
+						queue = append(queue, input)
+					}
+				}
+			}
+		}
+	}
+	return names
+}
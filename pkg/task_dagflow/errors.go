@@ -0,0 +1,173 @@
+package task_dagflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Sentinels of errors returned by flows, match them with errors.Is,
+// or get the details with errors.As and the error types below
+var (
+	ErrFlowTimeout       = errors.New("task dagflow execution timed out")
+	ErrTaskTimeout       = errors.New("task timed out")
+	ErrTaskPanic         = errors.New("task panicked")
+	ErrUnreachable       = errors.New("task flow has unreachable output types")
+	ErrCycle             = errors.New("task graph has a cycle")
+	ErrNilResult         = errors.New("task create function returned nil")
+	ErrCompensation      = errors.New("task compensation failed")
+	ErrMissingDependency = errors.New("task dependency not provided")
+)
+
+// TaskError is returned by Execute when a task fails, Err is the cause: a *TaskTimeoutError,
+// a *PanicError, the task's own error, or all errors of a task with fallbacks joined
+type TaskError struct {
+	TaskName   string
+	OutputType reflect.Type
+	Err        error
+}
+
+func (e *TaskError) Error() string {
+	return fmt.Sprintf("task %s failed: %v", e.TaskName, e.Err)
+}
+
+func (e *TaskError) Unwrap() error {
+	return e.Err
+}
+
+// FlowTimeoutError is returned when the flow did not finish within its timeout,
+// it matches both ErrFlowTimeout and context.DeadlineExceeded
+type FlowTimeoutError struct {
+	FlowName string
+	Timeout  time.Duration
+}
+
+func (e *FlowTimeoutError) Error() string {
+	return fmt.Sprintf("%s: %s after %s", ErrFlowTimeout, e.FlowName, e.Timeout)
+}
+
+func (e *FlowTimeoutError) Is(target error) bool {
+	return target == ErrFlowTimeout
+}
+
+func (e *FlowTimeoutError) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
+// TaskTimeoutError is the cause of a task failure when the task did not finish within its own timeout,
+// it matches both ErrTaskTimeout and context.DeadlineExceeded
+type TaskTimeoutError struct {
+	TaskName   string
+	OutputType reflect.Type
+	Timeout    time.Duration
+}
+
+func (e *TaskTimeoutError) Error() string {
+	return fmt.Sprintf("%s: %s after %s", ErrTaskTimeout, e.TaskName, e.Timeout)
+}
+
+func (e *TaskTimeoutError) Is(target error) bool {
+	return target == ErrTaskTimeout
+}
+
+func (e *TaskTimeoutError) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
+// PanicError is the cause of a task failure when the task panicked, Stack is the stack of the panic
+type PanicError struct {
+	TaskName   string
+	OutputType reflect.Type
+	Value      any
+	Stack      []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("%s: %s: %v", ErrTaskPanic, e.TaskName, e.Value)
+}
+
+func (e *PanicError) Is(target error) bool {
+	return target == ErrTaskPanic
+}
+
+// UnreachableError is returned when creating a flow whose targets can't be produced from the collection inputs
+type UnreachableError struct {
+	OutputTypes []reflect.Type
+}
+
+func (e *UnreachableError) Error() string {
+	return fmt.Sprintf("%s: %v", ErrUnreachable, e.OutputTypes)
+}
+
+func (e *UnreachableError) Is(target error) bool {
+	return target == ErrUnreachable
+}
+
+// CycleError is returned instead of UnreachableError when targets are unreachable because tasks
+// depend on each other, TaskNames lists the tasks of the cycle, each one consuming the output of the next
+type CycleError struct {
+	TaskNames   []string
+	OutputTypes []reflect.Type
+}
+
+func (e *CycleError) Error() string {
+	return fmt.Sprintf("%s: %s -> %s", ErrCycle, strings.Join(e.TaskNames, " -> "), e.TaskNames[0])
+}
+
+func (e *CycleError) Is(target error) bool {
+	return target == ErrCycle
+}
+
+// NilResultError is returned when the create function of a task returned a nil task,
+// at registration TaskName and OutputType are empty as the task was never created
+type NilResultError struct {
+	TaskName   string
+	OutputType reflect.Type
+}
+
+func (e *NilResultError) Error() string {
+	if e.TaskName == "" {
+		return ErrNilResult.Error()
+	}
+	return fmt.Sprintf("%s: %s", ErrNilResult, e.TaskName)
+}
+
+func (e *NilResultError) Is(target error) bool {
+	return target == ErrNilResult
+}
+
+// CompensationError is joined to the error of a failed run when the compensation of a task failed
+type CompensationError struct {
+	TaskName   string
+	OutputType reflect.Type
+	Err        error
+}
+
+func (e *CompensationError) Error() string {
+	return fmt.Sprintf("compensation of task %s failed: %v", e.TaskName, e.Err)
+}
+
+func (e *CompensationError) Is(target error) bool {
+	return target == ErrCompensation
+}
+
+func (e *CompensationError) Unwrap() error {
+	return e.Err
+}
+
+// MissingDependencyError is returned by Resolve when no value of Type was provided,
+// registering a TaskConstructor resolving it fails with this error
+type MissingDependencyError struct {
+	Type reflect.Type
+}
+
+func (e *MissingDependencyError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrMissingDependency, typeName(e.Type))
+}
+
+func (e *MissingDependencyError) Is(target error) bool {
+	return target == ErrMissingDependency
+}
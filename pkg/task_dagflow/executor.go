@@ -2,62 +2,228 @@ package task_dagflow
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"reflect"
+	"runtime/debug"
 	"time"
 
 	tools "github.com/Steve-Lee-CST/go-pico-tool/tools"
-
-	mapset "github.com/deckarep/golang-set/v2"
 )
 
 type taskResult[CT ICollection] struct {
+	Index    int32
 	Meta     *taskMeta[CT]
+	Producer string
 	TimeCost time.Duration
 	Err      error
 }
 
-type taskExecutor[CT ICollection] struct {
-	Meta   *taskMeta[CT]
-	Task   ITask[CT]
-	Blocks mapset.Set[reflect.Type]
+// taskProducer is one task able to produce the output: the primary or a fallback
+type taskProducer[CT ICollection] struct {
+	FlowName string
+	// Attempt is 1 for the primary task, then counts fallbacks
+	Attempt int
+	Meta    *taskMeta[CT]
+	Task    ITask[CT]
+	Handler TaskHandler[CT]
 }
 
-func newTaskExecutor[CT ICollection](meta *taskMeta[CT]) (*taskExecutor[CT], error) {
-	task, err := CreateTask(meta.CreateFunc)
+// newTaskProducer creates the task, flow interceptors wrap the task's own interceptors,
+// in checked mode the task itself is wrapped by the contract check.
+// A slot of the task's resource class is held around the whole chain.
+func newTaskProducer[CT ICollection](
+	config flowConfig[CT], attempt int, meta *taskMeta[CT], tracker *AccessTracker,
+) (*taskProducer[CT], error) {
+	var task ITask[CT] = meta.stateless
+	var err error
+	if task == nil {
+		task, err = CreateTask(meta.CreateFunc)
+	}
+	var nilResult *NilResultError
+	if errors.As(err, &nilResult) {
+		nilResult.TaskName, nilResult.OutputType = meta.Name, meta.OutputType
+		return nil, nilResult
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to create task %s: %w", meta.Name, err)
 	}
-	return &taskExecutor[CT]{
-		Meta:   meta,
-		Task:   task,
-		Blocks: meta.InputTypes.Clone(),
+	chain := make([]Interceptor[CT], 0, len(config.Interceptors)+len(meta.Interceptors))
+	chain = append(chain, config.Interceptors...)
+	chain = append(chain, meta.Interceptors...)
+	handler := TaskHandler[CT](task.Execute)
+	if tracker != nil {
+		handler = contractHandler(tracker, meta, handler)
+	}
+	handler = chainInterceptors(newTaskInfo(config.Name, meta), chain, handler)
+	if meta.ResourceClass != "" {
+		handler = resourceHandler(resources.Limiter(meta.ResourceClass), handler)
+	}
+	return &taskProducer[CT]{
+		FlowName: config.Name,
+		Attempt:  attempt,
+		Meta:     meta,
+		Task:     task,
+		Handler:  handler,
 	}, nil
 }
 
-func (te *taskExecutor[CT]) RemoveAndCheckBlock(block reflect.Type) bool {
-	if te.Blocks.Contains(block) {
-		te.Blocks.Remove(block)
-		if te.Blocks.IsEmpty() {
-			return true
+// Execute runs the task with its timeout. If returned is not nil it is closed once the task itself returned,
+// which is after Execute for a task ignoring its ctx once timed out.
+func (tp *taskProducer[CT]) Execute(ctx context.Context, collection CT, returned chan<- struct{}) error {
+	_, err := tools.RunFuncWithTimeout(
+		tp.withMetadata(ctx), tp.Meta.Timeout,
+		func(subCtx context.Context) (_ interface{}, err error) {
+			if returned != nil {
+				defer close(returned)
+			}
+			defer tp.recoverPanic(&err)
+			return struct{}{}, tp.Handler(subCtx, collection)
+		},
+	)
+	return tp.wrapTimeout(ctx, err)
+}
+
+// recoverPanic turns a panic of the task into a *PanicError
+func (tp *taskProducer[CT]) recoverPanic(err *error) {
+	if r := recover(); r != nil {
+		*err = &PanicError{TaskName: tp.Meta.Name, OutputType: tp.Meta.OutputType, Value: r, Stack: debug.Stack()}
+	}
+}
+
+// wrapTimeout turns the deadline of the task's own timeout into a *TaskTimeoutError,
+// a deadline of ctx is left to the caller
+func (tp *taskProducer[CT]) wrapTimeout(ctx context.Context, err error) error {
+	if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+		return &TaskTimeoutError{TaskName: tp.Meta.Name, OutputType: tp.Meta.OutputType, Timeout: tp.Meta.Timeout}
+	}
+	return err
+}
+
+// newSharedProducers creates the producers of the task and its fallbacks once for all flows of a snapshot,
+// nil if one of them is not stateless
+func newSharedProducers[CT ICollection](config flowConfig[CT], meta *taskMeta[CT]) []*taskProducer[CT] {
+	producers := make([]*taskProducer[CT], 0, 1+len(meta.Fallbacks))
+	for i, producerMeta := range append([]*taskMeta[CT]{meta}, meta.Fallbacks...) {
+		if producerMeta.stateless == nil {
+			return nil
+		}
+		producer, err := newTaskProducer(config, i+1, producerMeta, nil)
+		if err != nil {
+			return nil
+		}
+		producers = append(producers, producer)
+	}
+	return producers
+}
+
+type taskExecutor[CT ICollection] struct {
+	// Index is the position of the task in the flow plan
+	Index int32
+	Meta  *taskMeta[CT]
+	// Producers[0] is the primary task, followed by fallbacks in registration order
+	Producers []*taskProducer[CT]
+}
+
+func newTaskExecutor[CT ICollection](
+	config flowConfig[CT], index int32, meta *taskMeta[CT], tracker *AccessTracker,
+) (taskExecutor[CT], error) {
+	if meta.producers != nil && tracker == nil {
+		return taskExecutor[CT]{Index: index, Meta: meta, Producers: meta.producers}, nil
+	}
+	producers := make([]*taskProducer[CT], 0, 1+len(meta.Fallbacks))
+	for i, producerMeta := range append([]*taskMeta[CT]{meta}, meta.Fallbacks...) {
+		producer, err := newTaskProducer(config, i+1, producerMeta, tracker)
+		if err != nil {
+			return taskExecutor[CT]{}, err
 		}
+		producers = append(producers, producer)
 	}
-	return false
+	return taskExecutor[CT]{
+		Index:     index,
+		Meta:      meta,
+		Producers: producers,
+	}, nil
 }
 
 func (te *taskExecutor[CT]) Execute(
-	ctx context.Context, collection CT, resultChan chan *taskResult[CT],
+	ctx context.Context, collection CT, results chan<- taskResult[CT],
 ) {
 	startTime := time.Now()
-	_, err := tools.RunFuncWithTimeout(
-		ctx, te.Meta.Timeout,
-		func(subCtx context.Context) (interface{}, error) {
-			return struct{}{}, te.Task.Execute(ctx, collection)
-		},
-	)
-	resultChan <- &taskResult[CT]{
+	producer, err := te.produce(ctx, collection)
+	results <- taskResult[CT]{
+		Index:    te.Index,
 		Meta:     te.Meta,
+		Producer: producer,
 		Err:      err,
 		TimeCost: time.Since(startTime),
 	}
 }
+
+type producerResult struct {
+	Name     string
+	Err      error
+	Returned <-chan struct{}
+}
+
+// produce runs the primary task, a fallback starts when the previous producer fails or times out,
+// or after its HedgeDelay if the previous producer is still running. The first success wins.
+// Without a HedgeDelay, a fallback waits for the tasks of failed producers to return, even past their timeout,
+// so producers ignoring ctx never write the collection at the same time.
+func (te *taskExecutor[CT]) produce(ctx context.Context, collection CT) (string, error) {
+	if len(te.Producers) == 1 {
+		return te.Producers[0].Meta.Name, te.Producers[0].Execute(ctx, collection, nil)
+	}
+
+	subCtx, cancel := context.WithCancel(ctx)
+	defer cancel() // stop hedged producers which lost the race
+	results := make(chan producerResult, len(te.Producers))
+	next, running := 0, 0
+	var hedge <-chan time.Time
+	launch := func() {
+		producer, returned := te.Producers[next], make(chan struct{})
+		go func() {
+			err := producer.Execute(subCtx, collection, returned)
+			results <- producerResult{Name: producer.Meta.Name, Err: err, Returned: returned}
+		}()
+		next++
+		running++
+		hedge = nil
+		if next < len(te.Producers) && te.Producers[next].Meta.HedgeDelay > 0 {
+			hedge = time.After(te.Producers[next].Meta.HedgeDelay)
+		}
+	}
+
+	launch()
+	errs := make([]error, 0, len(te.Producers))
+	failed := make([]<-chan struct{}, 0, len(te.Producers))
+	for running > 0 {
+		select {
+		case <-hedge:
+			launch()
+		case result := <-results:
+			running--
+			if result.Err == nil {
+				return result.Name, nil
+			}
+			errs = append(errs, fmt.Errorf("%s: %w", result.Name, result.Err))
+			failed = append(failed, result.Returned)
+			if running == 0 && next < len(te.Producers) && ctx.Err() == nil &&
+				(te.Producers[next].Meta.HedgeDelay > 0 || awaitReturned(ctx, failed)) {
+				launch()
+			}
+		}
+	}
+	return "", errors.Join(errs...)
+}
+
+// awaitReturned waits for the tasks of failed producers, false if ctx is done first
+func awaitReturned(ctx context.Context, returned []<-chan struct{}) bool {
+	for _, done := range returned {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return false
+		}
+	}
+	return true
+}
@@ -1,49 +1,200 @@
 package task_dagflow
 
 import (
-	"fmt"
-	"reflect"
+	"errors"
+	"sync"
+	"sync/atomic"
 )
 
+// ErrGraphNotCreated is returned when a flow is requested before Factory.CreateGraph or Factory.Reload
+var ErrGraphNotCreated = errors.New("task graph not created, call CreateGraph or Reload first")
+
+// ErrNoTasks is returned by CreateGraph and Reload for a task set without tasks, the current snapshot is kept
+var ErrNoTasks = errors.New("no tasks registered")
+
+// IFactory is the type-erased view of a Factory, used by tools that handle factories of different collections
+type IFactory interface {
+	Name() string
+	GraphSpec() GraphSpec
+	SnapshotGraphSpec() (GraphSpec, error)
+	AddRunObserver(observer RunObserver)
+}
+
+var _ IFactory = (*Factory[ICollection])(nil)
+
+// Factory registers tasks and creates task flows, all methods are concurrent-safe.
+// Flows are created from the current Snapshot: registrations take effect at the next CreateGraph,
+// Reload swaps in a whole new task set at runtime.
+// Flows run concurrently: interceptors, run observers and variant selectors must be concurrent-safe.
 type Factory[CT ICollection] struct {
-	outputToTaskMeta map[reflect.Type]*taskMeta[CT]
-	graph            *graph[CT]
+	config       Config
+	tasks        *TaskSet[CT]
+	observers    runObservers
+	interceptors []Interceptor[CT]
+	version      uint64
+	snapshot     atomic.Pointer[Snapshot[CT]]
+
+	rwLock sync.RWMutex
 }
 
 func NewFactory[CT ICollection]() *Factory[CT] {
+	return NewFactoryWithConfig[CT](GetDefaultConfig())
+}
+
+func NewFactoryWithConfig[CT ICollection](config Config) *Factory[CT] {
+	if config.Name == "" {
+		config.Name = GetDefaultConfig().Name
+	}
+	if config.Deps == nil {
+		config.Deps = NewDeps()
+	}
 	return &Factory[CT]{
-		outputToTaskMeta: make(map[reflect.Type]*taskMeta[CT]),
+		config: config,
+		tasks:  NewTaskSet[CT](),
+	}
+}
+
+func (f *Factory[CT]) Name() string {
+	return f.config.Name
+}
+
+func (f *Factory[CT]) RegisterTask(createFunc TaskCreateFunc[CT], options ...TaskOption[CT]) error {
+	f.rwLock.Lock()
+	defer f.rwLock.Unlock()
+	return f.tasks.RegisterTask(createFunc, options...)
+}
+
+// Deps returns the dependency container of the factory, provide dependencies before registering
+// the constructors resolving them
+func (f *Factory[CT]) Deps() *Deps {
+	return f.config.Deps
+}
+
+// RegisterConstructor registers the task created by constructor with the factory's dependencies,
+// it fails with a *MissingDependencyError if the constructor resolves a dependency not provided yet
+func (f *Factory[CT]) RegisterConstructor(constructor TaskConstructor[CT], options ...TaskOption[CT]) error {
+	return f.RegisterTask(constructor.Bind(f.config.Deps), options...)
+}
+
+// RegisterVariantTasks see TaskSet.RegisterVariantTasks
+func (f *Factory[CT]) RegisterVariantTasks(
+	selector VariantSelector[CT], createFuncs []TaskCreateFunc[CT], options ...TaskOption[CT],
+) error {
+	f.rwLock.Lock()
+	defer f.rwLock.Unlock()
+	return f.tasks.RegisterVariantTasks(selector, createFuncs, options...)
+}
+
+// RegisterFallbackTask see TaskSet.RegisterFallbackTask
+func (f *Factory[CT]) RegisterFallbackTask(createFunc TaskCreateFunc[CT], options ...TaskOption[CT]) error {
+	f.rwLock.Lock()
+	defer f.rwLock.Unlock()
+	return f.tasks.RegisterFallbackTask(createFunc, options...)
+}
+
+// Use appends interceptors running around every task, effective from the next snapshot
+func (f *Factory[CT]) Use(interceptors ...Interceptor[CT]) {
+	f.rwLock.Lock()
+	defer f.rwLock.Unlock()
+	f.interceptors = append(f.interceptors, interceptors...)
+}
+
+// AddRunObserver adds an observer called after each execution of flows created by the factory,
+// effective immediately for flows created afterwards, whatever the snapshot
+func (f *Factory[CT]) AddRunObserver(observer RunObserver) {
+	if observer == nil {
+		return
 	}
+	f.rwLock.Lock()
+	defer f.rwLock.Unlock()
+	f.observers.Finish = append(f.observers.Finish, observer)
 }
 
-func (f *Factory[CT]) RegisterTask(createFunc TaskCreateFunc[CT]) error {
-	meta, err := newTaskMeta(createFunc)
+// AddRunStartObserver adds an observer called before each execution of flows created by the factory,
+// effective immediately for flows created afterwards, whatever the snapshot
+func (f *Factory[CT]) AddRunStartObserver(observer RunStartObserver) {
+	if observer == nil {
+		return
+	}
+	f.rwLock.Lock()
+	defer f.rwLock.Unlock()
+	f.observers.Start = append(f.observers.Start, observer)
+}
+
+func (f *Factory[CT]) getObservers() runObservers {
+	f.rwLock.RLock()
+	defer f.rwLock.RUnlock()
+	return runObservers{
+		Start:  append([]RunStartObserver(nil), f.observers.Start...),
+		Finish: append([]RunObserver(nil), f.observers.Finish...),
+	}
+}
+
+// GraphSpec exports the registered tasks, including registrations not in a snapshot yet
+func (f *Factory[CT]) GraphSpec() GraphSpec {
+	f.rwLock.RLock()
+	defer f.rwLock.RUnlock()
+	return newGraphSpec(f.config.Name, f.tasks.metas())
+}
+
+// SnapshotGraphSpec exports the tasks of the current snapshot which flows run on, with its version,
+// ErrGraphNotCreated if there is none yet
+func (f *Factory[CT]) SnapshotGraphSpec() (GraphSpec, error) {
+	snapshot, err := f.Snapshot()
 	if err != nil {
-		return err
+		return GraphSpec{}, err
 	}
-	if _, exists := f.outputToTaskMeta[meta.OutputType]; exists {
-		return fmt.Errorf("task with output type %s already registered", meta.OutputType)
+	return snapshot.GraphSpec(), nil
+}
+
+// buildSnapshot must be called with the write lock held
+func (f *Factory[CT]) buildSnapshot() *Snapshot[CT] {
+	f.version++
+	snapshot := newSnapshot(f.config, f.version, f.tasks, f.interceptors, f.getObservers)
+	f.snapshot.Store(snapshot)
+	return snapshot
+}
+
+// CreateGraph builds a new snapshot from the current registrations and makes it current,
+// it fails with ErrNoTasks if nothing is registered
+func (f *Factory[CT]) CreateGraph() error {
+	f.rwLock.Lock()
+	defer f.rwLock.Unlock()
+	if f.tasks.empty() {
+		return ErrNoTasks
 	}
-	f.outputToTaskMeta[meta.OutputType] = meta
+	f.buildSnapshot()
 	return nil
 }
 
-func (f *Factory[CT]) CreateGraph() {
-	tasks := make([]*taskMeta[CT], 0)
-	for _, meta := range f.outputToTaskMeta {
-		tasks = append(tasks, meta)
+// Reload atomically replaces the registrations with tasks and makes a snapshot of them current.
+// Flows already created keep running with the snapshot they were created from.
+func (f *Factory[CT]) Reload(tasks *TaskSet[CT]) (*Snapshot[CT], error) {
+	if tasks == nil {
+		return nil, errors.New("task set must not be nil")
+	}
+	if tasks.empty() {
+		return nil, ErrNoTasks
 	}
+	f.rwLock.Lock()
+	defer f.rwLock.Unlock()
+	f.tasks = tasks.clone()
+	return f.buildSnapshot(), nil
+}
 
-	if f.graph == nil {
-		f.graph = newGraph(tasks)
+// Snapshot returns the current snapshot, ErrGraphNotCreated if there is none yet
+func (f *Factory[CT]) Snapshot() (*Snapshot[CT], error) {
+	snapshot := f.snapshot.Load()
+	if snapshot == nil {
+		return nil, ErrGraphNotCreated
 	}
+	return snapshot, nil
 }
 
 func (f *Factory[CT]) CreateTaskDagflow(collection CT) (*TaskDagflow[CT], error) {
-	metas, err := f.graph.GetMinTaskMetas(collection)
+	snapshot, err := f.Snapshot()
 	if err != nil {
 		return nil, err
 	}
-
-	return NewTaskDagflow(metas, collection)
+	return snapshot.CreateTaskDagflow(collection)
 }
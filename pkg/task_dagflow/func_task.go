@@ -0,0 +1,163 @@
+package task_dagflow
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// FuncTask is an ITask built from a plain function with the signature:
+//
+//	func(ctx context.Context, in1 T1, in2 T2, ...) (Out, error)
+//
+// InputTypes() are T1, T2, ... and OutputType() is Out.
+// Inputs are read from the collection by its getters (`func() T`) and the output is written
+// by its setter (`func(Out)`), getters and setters are matched by type, not by method name.
+// A function without inputs is a source task, its InputTypes() is []reflect.Type{nil}.
+type FuncTask[CT ICollection] struct {
+	name       string
+	timeout    time.Duration
+	fn         reflect.Value
+	inputTypes []reflect.Type
+	outputType reflect.Type
+	getters    []string
+	setter     string
+}
+
+// NewFuncTask creates a FuncTask, fn and the getters and setter of CT are checked here
+func NewFuncTask[CT ICollection](name string, timeout time.Duration, fn any) (*FuncTask[CT], error) {
+	fnType := reflect.TypeOf(fn)
+	if fnType == nil || fnType.Kind() != reflect.Func {
+		return nil, fmt.Errorf("task %s: expected a function, got %T", name, fn)
+	}
+	if fnType.IsVariadic() || fnType.NumIn() == 0 || fnType.In(0) != contextType {
+		return nil, fmt.Errorf("task %s: function %s must take context.Context as first parameter", name, fnType)
+	}
+	if fnType.NumOut() != 2 || fnType.Out(1) != errorType {
+		return nil, fmt.Errorf("task %s: function %s must return (output, error)", name, fnType)
+	}
+
+	cType := reflect.TypeOf((*CT)(nil)).Elem()
+	task := &FuncTask[CT]{
+		name:       name,
+		timeout:    timeout,
+		fn:         reflect.ValueOf(fn),
+		outputType: fnType.Out(0),
+	}
+	for i := 1; i < fnType.NumIn(); i++ {
+		inputType := fnType.In(i)
+		if inputType == task.outputType {
+			return nil, fmt.Errorf("task %s: %s is both input and output", name, typeName(inputType))
+		}
+		getter, err := findAccessor(cType, inputType, true)
+		if err != nil {
+			return nil, fmt.Errorf("task %s: %w", name, err)
+		}
+		task.inputTypes = append(task.inputTypes, inputType)
+		task.getters = append(task.getters, getter)
+	}
+	if len(task.inputTypes) == 0 {
+		task.inputTypes = []reflect.Type{nil}
+	}
+	setter, err := findAccessor(cType, task.outputType, false)
+	if err != nil {
+		return nil, fmt.Errorf("task %s: %w", name, err)
+	}
+	task.setter = setter
+	return task, nil
+}
+
+// NewFuncTaskCreateFunc wraps NewFuncTask as a TaskCreateFunc
+func NewFuncTaskCreateFunc[CT ICollection](name string, timeout time.Duration, fn any) TaskCreateFunc[CT] {
+	return func() (ITask[CT], error) {
+		task, err := NewFuncTask[CT](name, timeout, fn)
+		if err != nil {
+			return nil, err
+		}
+		return task, nil
+	}
+}
+
+// findAccessor returns the name of the only method of cType which gets (`func() T`) or sets (`func(T)`) valueType
+func findAccessor(cType reflect.Type, valueType reflect.Type, getter bool) (string, error) {
+	found := make([]string, 0, 1)
+	for i := 0; i < cType.NumMethod(); i++ {
+		method := cType.Method(i)
+		methodType := method.Type
+		// methods of a concrete type take the receiver as first parameter, methods of an interface don't
+		offset := 0
+		if cType.Kind() != reflect.Interface {
+			offset = 1
+		}
+		if getter && methodType.NumIn() == offset && methodType.NumOut() == 1 &&
+			methodType.Out(0) == valueType {
+			found = append(found, method.Name)
+		}
+		if !getter && methodType.NumIn() == offset+1 && methodType.NumOut() == 0 &&
+			methodType.In(offset) == valueType {
+			found = append(found, method.Name)
+		}
+	}
+
+	kind := "setter func(" + typeName(valueType) + ")"
+	if getter {
+		kind = "getter func() " + typeName(valueType)
+	}
+	switch len(found) {
+	case 0:
+		return "", fmt.Errorf("collection %s has no %s", cType, kind)
+	case 1:
+		return found[0], nil
+	default:
+		return "", fmt.Errorf("collection %s has more than one %s: %v", cType, kind, found)
+	}
+}
+
+func (t *FuncTask[CT]) Name() string {
+	return t.name
+}
+
+func (t *FuncTask[CT]) InputTypes() []reflect.Type {
+	return t.inputTypes
+}
+
+func (t *FuncTask[CT]) OutputType() reflect.Type {
+	return t.outputType
+}
+
+func (t *FuncTask[CT]) Timeout() time.Duration {
+	return t.timeout
+}
+
+// Stateless is true: the task is created once and shared by all flows, see IStatelessTask
+func (t *FuncTask[CT]) Stateless() bool {
+	return true
+}
+
+// Execute reads inputs from the collection, calls the function and writes its output when it succeeds
+// and ctx is not done
+func (t *FuncTask[CT]) Execute(ctx context.Context, collection CT) error {
+	cValue := reflect.ValueOf(collection)
+	args := make([]reflect.Value, 0, len(t.getters)+1)
+	args = append(args, reflect.ValueOf(&ctx).Elem())
+	for _, getter := range t.getters {
+		args = append(args, cValue.MethodByName(getter).Call(nil)[0])
+	}
+
+	results := t.fn.Call(args)
+	if err, _ := results[1].Interface().(error); err != nil {
+		return err
+	}
+	// the task may have timed out and been replaced by a fallback meanwhile
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	cValue.MethodByName(t.setter).Call([]reflect.Value{results[0]})
+	return nil
+}
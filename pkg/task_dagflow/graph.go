@@ -3,129 +3,333 @@ package task_dagflow
 import (
 	"errors"
 	"reflect"
+	"slices"
 
 	"github.com/Steve-Lee-CST/go-pico-tool/tools"
-	mapset "github.com/deckarep/golang-set/v2"
 )
 
+// node produces one output type: by a single task, or by the variant selected per collection
 type node[CT ICollection] struct {
-	Meta      *taskMeta[CT]
-	Reachable bool
+	Meta     *taskMeta[CT]
+	Variants *variantGroup[CT]
 }
 
 func newNode[CT ICollection](meta *taskMeta[CT]) *node[CT] {
 	return &node[CT]{
-		Meta:      meta,
-		Reachable: false,
+		Meta: meta,
 	}
 }
 
+func newVariantNode[CT ICollection](variants *variantGroup[CT]) *node[CT] {
+	return &node[CT]{
+		Variants: variants,
+	}
+}
+
+func (n *node[CT]) Select(collection CT) (*taskMeta[CT], error) {
+	if n.Variants != nil {
+		return n.Variants.Select(collection)
+	}
+	return n.Meta, nil
+}
+
+// graph indexes every type used by its tasks as a small integer, so a flow is planned
+// with slices and bitsets instead of maps and sets of reflect.Type
 type graph[CT ICollection] struct {
-	outputToNode   map[reflect.Type]*node[CT]
-	inputToNodes   map[reflect.Type][]*node[CT]
-	outputToInputs map[reflect.Type]mapset.Set[reflect.Type]
+	typeIDs map[reflect.Type]int32
+	types   []reflect.Type
+	// nodes[id] produces types[id], nil if no task produces it
+	nodes []*node[CT]
+	// consumers[id] are all tasks, every variant included, having types[id] as input
+	consumers [][]*taskMeta[CT]
 }
 
-func newGraph[CT ICollection](metas []*taskMeta[CT]) *graph[CT] {
+func newGraph[CT ICollection](metas []*taskMeta[CT], variants []*variantGroup[CT]) *graph[CT] {
 	g := &graph[CT]{
-		outputToNode:   make(map[reflect.Type]*node[CT]),
-		inputToNodes:   make(map[reflect.Type][]*node[CT]),
-		outputToInputs: make(map[reflect.Type]mapset.Set[reflect.Type]),
+		typeIDs: make(map[reflect.Type]int32),
 	}
-	for _, meta := range metas {
-		n := newNode(meta)
-		g.outputToNode[meta.OutputType] = n
-		for inputType := range meta.InputTypes.Iter() {
-			g.inputToNodes[inputType] = append(g.inputToNodes[inputType], n)
+	all := slices.Clone(metas)
+	for _, group := range variants {
+		for _, name := range group.Names {
+			all = append(all, group.Metas[name])
 		}
 	}
-	for output := range g.outputToNode {
-		g.outputToInputs[output] = g.getInputs(output)
+	for _, meta := range all {
+		g.index(meta)
+	}
+	g.nodes = make([]*node[CT], len(g.types))
+	g.consumers = make([][]*taskMeta[CT], len(g.types))
+	for _, meta := range metas {
+		g.nodes[meta.outputID] = newNode(meta)
+	}
+	for _, group := range variants {
+		g.nodes[g.typeIDs[group.OutputType]] = newVariantNode(group)
+	}
+	for _, meta := range all {
+		for _, inputID := range meta.inputIDs {
+			g.consumers[inputID] = append(g.consumers[inputID], meta)
+		}
 	}
-
 	return g
 }
 
-// getInputs finds all input types for the given output type using union-find algorithm
-func (g *graph[CT]) getInputs(outputType reflect.Type) mapset.Set[reflect.Type] {
-	node, exists := g.outputToNode[outputType]
-	if !exists {
-		return nil
+func (g *graph[CT]) typeID(t reflect.Type) int32 {
+	id, ok := g.typeIDs[t]
+	if !ok {
+		id = int32(len(g.types))
+		g.typeIDs[t] = id
+		g.types = append(g.types, t)
 	}
+	return id
+}
 
-	inputList := tools.NewQueue[reflect.Type]()
-	inputs := node.Meta.InputTypes.Clone()
-	for inputType := range inputs.Iter() {
-		if inputType != nil {
-			inputList.Enqueue(inputType)
-		}
+// index assigns ids to the meta's types, nil inputs are dropped since they are always available
+func (g *graph[CT]) index(meta *taskMeta[CT]) {
+	meta.outputID = g.typeID(meta.OutputType)
+	meta.inputIDs = make([]int32, 0, len(meta.inputList))
+	for _, inputType := range meta.inputList {
+		meta.inputIDs = append(meta.inputIDs, g.typeID(inputType))
 	}
-	for inputList.Size() > 0 {
-		inputType, exist := inputList.Dequeue()
-		if !exist {
-			break
+	slices.Sort(meta.inputIDs)
+}
+
+// collectionTypes returns ids of the collection's input types known to the graph,
+// and its target types: nil is dropped from both
+func (g *graph[CT]) collectionTypes(collection CT) (provided tools.Bitset, targets []reflect.Type, err error) {
+	provided = tools.NewBitset(len(g.types))
+	for _, inputType := range collection.InputTypes() {
+		if id, ok := g.typeIDs[inputType]; ok && inputType != nil {
+			provided.Set(int(id))
 		}
-		// find in graph
-		if meta, ok := g.outputToNode[inputType]; ok {
-			for childInputType := range meta.Meta.InputTypes.Iter() {
-				if childInputType != nil && !inputs.Contains(childInputType) {
-					inputs.Add(childInputType)
-					inputList.Enqueue(childInputType)
-				}
-			}
+	}
+	targets = make([]reflect.Type, 0, len(collection.TargetTypes()))
+	for _, targetType := range collection.TargetTypes() {
+		if targetType != nil && !slices.Contains(targets, targetType) {
+			targets = append(targets, targetType)
 		}
 	}
-	return inputs
+	if len(targets) == 0 {
+		return nil, nil, errors.New("task flow must produce at least one output type")
+	}
+	return provided, targets, nil
 }
 
-func (g *graph[CT]) calReachStatus(
-	collectionMeta *collectionMeta[CT],
-) (reachableTypes, unReachableTypes mapset.Set[reflect.Type]) {
-	inputs := mapset.NewSet[reflect.Type]()
-	inputs.Append(collectionMeta.InputTypes.ToSlice()...)
-	inputs.Add(nil)
-	targets := mapset.NewSet[reflect.Type]()
-	targets.Append(collectionMeta.TargetTypes.ToSlice()...)
-
-	reachableTypes = mapset.NewSet[reflect.Type]()
-	for _, task := range g.outputToNode {
-		task.Reachable = false
-	}
-
-	for inputType := range inputs.Iter() {
-		reachableTypes.Add(inputType)
-	}
-	newNodeTag := true
-	for newNodeTag {
-		newNodeTag = false
-		for output, node := range g.outputToNode {
-			if node.Meta.InputTypes.IsSubset(reachableTypes) && !reachableTypes.Contains(output) {
-				reachableTypes.Add(output)
-				node.Reachable = true
-				newNodeTag = true
+// reach marks types which can be produced from the provided ones with the selected tasks:
+// every selected task waits for a counter of inputs, like a topological sort
+func (g *graph[CT]) reach(selected []*taskMeta[CT], provided tools.Bitset) tools.Bitset {
+	reachable := tools.NewBitset(len(g.types))
+	remaining := make([]int32, len(g.types))
+	queue := make([]int32, 0, len(g.types))
+	mark := func(id int32) {
+		if !reachable.Has(int(id)) {
+			reachable.Set(int(id))
+			queue = append(queue, id)
+		}
+	}
+	for id := range g.types {
+		if provided.Has(id) {
+			mark(int32(id))
+		}
+	}
+	for id, meta := range selected {
+		if meta == nil {
+			continue
+		}
+		remaining[id] = int32(len(meta.inputIDs))
+		if remaining[id] == 0 {
+			mark(int32(id))
+		}
+	}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, consumer := range g.consumers[id] {
+			if selected[consumer.outputID] != consumer {
+				continue
+			}
+			remaining[consumer.outputID]--
+			if remaining[consumer.outputID] == 0 {
+				mark(consumer.outputID)
 			}
 		}
 	}
-	unReachableTypes = targets.Difference(reachableTypes)
-	return
+	return reachable
 }
 
-func (g *graph[CT]) GetMinTaskMetas(collection CT) ([]*taskMeta[CT], error) {
-	collectionMeta, err := newCollectionMeta(collection)
+// Plan returns the flow plan producing the collection's target types: variants upstream of the targets
+// are selected by the collection, then only producers of targets and their transitive inputs are kept.
+func (g *graph[CT]) Plan(collection CT) (*flowPlan[CT], error) {
+	provided, targets, err := g.collectionTypes(collection)
 	if err != nil {
 		return nil, err
 	}
+	targetIDs := make([]int32, 0, len(targets))
+	for _, target := range targets {
+		if id, ok := g.typeIDs[target]; ok {
+			targetIDs = append(targetIDs, id)
+		}
+	}
 
-	reachableTypes, unReachableTypes := g.calReachStatus(collectionMeta)
-	if unReachableTypes.Cardinality() > 0 {
-		return nil, errors.New("task flow has unreachable output types: " + reflect.TypeOf(unReachableTypes).String())
+	// select producers walking back from targets, so selectors of variants the targets
+	// don't depend on are never called
+	selected := make([]*taskMeta[CT], len(g.types))
+	upstream := tools.NewBitset(len(g.types))
+	queue := slices.Clone(targetIDs)
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if upstream.Has(int(id)) || provided.Has(int(id)) || g.nodes[id] == nil {
+			continue
+		}
+		upstream.Set(int(id))
+		if selected[id], err = g.nodes[id].Select(collection); err != nil {
+			return nil, err
+		}
+		queue = append(queue, selected[id].inputIDs...)
 	}
 
-	taskMetas := make([]*taskMeta[CT], 0)
-	for outputType := range reachableTypes.Iter() {
-		if node, exists := g.outputToNode[outputType]; exists {
-			taskMetas = append(taskMetas, node.Meta)
+	reachable := g.reach(selected, provided)
+	unreachableTypes := make([]reflect.Type, 0)
+	for _, target := range targets {
+		id, ok := g.typeIDs[target]
+		if ok && reachable.Has(int(id)) {
+			continue
 		}
+		if !ok && slices.Contains(collection.InputTypes(), target) {
+			continue
+		}
+		unreachableTypes = append(unreachableTypes, target)
 	}
-	return taskMetas, nil
+	if len(unreachableTypes) > 0 {
+		if cycle := g.findCycle(selected, reachable, unreachableTypes); cycle != nil {
+			return nil, cycle
+		}
+		return nil, &UnreachableError{OutputTypes: unreachableTypes}
+	}
+
+	// walk back from targets, collection inputs are provided and need no producer
+	metas := make([]*taskMeta[CT], 0)
+	visited := tools.NewBitset(len(g.types))
+	queue = append(queue, targetIDs...)
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if visited.Has(int(id)) || provided.Has(int(id)) {
+			continue
+		}
+		visited.Set(int(id))
+		meta := selected[id]
+		if meta == nil || !reachable.Has(int(id)) {
+			continue
+		}
+		metas = append(metas, meta)
+		queue = append(queue, meta.inputIDs...)
+	}
+	return g.newFlowPlan(metas, provided), nil
+}
+
+// findCycle looks for selected tasks depending on each other upstream of the unreachable targets,
+// only unreachable types are followed since types of a cycle are never reachable
+func (g *graph[CT]) findCycle(
+	selected []*taskMeta[CT], reachable tools.Bitset, targets []reflect.Type,
+) *CycleError {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	states := make([]int8, len(g.types))
+	path := make([]int32, 0)
+	var visit func(id int32) []int32
+	visit = func(id int32) []int32 {
+		switch {
+		case states[id] == visiting:
+			return path[slices.Index(path, id):]
+		case states[id] == visited, selected[id] == nil, reachable.Has(int(id)):
+			return nil
+		}
+		states[id] = visiting
+		path = append(path, id)
+		for _, inputID := range selected[id].inputIDs {
+			if cycle := visit(inputID); cycle != nil {
+				return cycle
+			}
+		}
+		path = path[:len(path)-1]
+		states[id] = visited
+		return nil
+	}
+
+	for _, target := range targets {
+		id, ok := g.typeIDs[target]
+		if !ok {
+			continue
+		}
+		if cycle := visit(id); cycle != nil {
+			err := &CycleError{}
+			for _, cycleID := range cycle {
+				err.TaskNames = append(err.TaskNames, selected[cycleID].Name)
+				err.OutputTypes = append(err.OutputTypes, g.types[cycleID])
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// flowPlan is the compiled schedule of a flow: tasks are indexed by their position in metas,
+// a task is ready once waits[i] inputs have been produced by other tasks of the flow
+type flowPlan[CT ICollection] struct {
+	metas []*taskMeta[CT]
+	waits []int32
+	// tasks consuming the output of task i are dependents[offsets[i]:offsets[i+1]]
+	offsets    []int32
+	dependents []int32
+}
+
+func (g *graph[CT]) newFlowPlan(metas []*taskMeta[CT], provided tools.Bitset) *flowPlan[CT] {
+	producers := make([]int32, len(g.types))
+	for i := range producers {
+		producers[i] = -1
+	}
+	for i, meta := range metas {
+		producers[meta.outputID] = int32(i)
+	}
+
+	plan := &flowPlan[CT]{
+		metas:   metas,
+		waits:   make([]int32, len(metas)),
+		offsets: make([]int32, len(metas)+1),
+	}
+	// inputs neither provided nor produced in the flow are waited forever, the task never runs
+	for i, meta := range metas {
+		for _, inputID := range meta.inputIDs {
+			if provided.Has(int(inputID)) {
+				continue
+			}
+			plan.waits[i]++
+			if producer := producers[inputID]; producer >= 0 {
+				plan.offsets[producer+1]++
+			}
+		}
+	}
+	for i := 1; i < len(plan.offsets); i++ {
+		plan.offsets[i] += plan.offsets[i-1]
+	}
+	plan.dependents = make([]int32, plan.offsets[len(metas)])
+	filled := slices.Clone(plan.offsets[:len(metas)])
+	for i, meta := range metas {
+		for _, inputID := range meta.inputIDs {
+			if producer := producers[inputID]; producer >= 0 && !provided.Has(int(inputID)) {
+				plan.dependents[filled[producer]] = int32(i)
+				filled[producer]++
+			}
+		}
+	}
+	return plan
+}
+
+// Dependents returns indexes of tasks consuming the output of task i
+func (p *flowPlan[CT]) Dependents(i int32) []int32 {
+	return p.dependents[p.offsets[i]:p.offsets[i+1]]
 }
@@ -0,0 +1,69 @@
+package task_dagflow
+
+import (
+	"context"
+	"reflect"
+	"time"
+)
+
+// TaskHandler executes a task with the collection, the innermost handler is ITask.Execute
+type TaskHandler[CT ICollection] func(ctx context.Context, collection CT) error
+
+// TaskInfo describes the task being intercepted
+type TaskInfo struct {
+	FlowName string
+	Name     string
+	// InputTypes is shared by all runs of the task and must not be modified
+	InputTypes []reflect.Type
+	OutputType reflect.Type
+	Timeout    time.Duration
+	// ResourceClass is set by WithResourceClass, the task holds a slot of the class while interceptors run
+	ResourceClass string
+}
+
+// Interceptor wraps the execution of a task, just like gin middleware around ITask.Execute.
+// Call next to continue the chain, or return without calling it to short-circuit the task.
+type Interceptor[CT ICollection] func(ctx context.Context, info TaskInfo, collection CT, next TaskHandler[CT]) error
+
+// TaskOption customizes a task at registration
+type TaskOption[CT ICollection] func(meta *taskMeta[CT])
+
+// WithInterceptors appends interceptors running only around this task, inside factory interceptors
+func WithInterceptors[CT ICollection](interceptors ...Interceptor[CT]) TaskOption[CT] {
+	return func(meta *taskMeta[CT]) {
+		meta.Interceptors = append(meta.Interceptors, interceptors...)
+	}
+}
+
+// WithHedgeDelay only works on fallback tasks: the fallback is raced against the previous producer
+// if it has not finished after delay, instead of waiting for it to fail.
+// Raced producers may run at the same time, they should stop writing the collection once ctx is done.
+func WithHedgeDelay[CT ICollection](delay time.Duration) TaskOption[CT] {
+	return func(meta *taskMeta[CT]) {
+		meta.HedgeDelay = delay
+	}
+}
+
+func newTaskInfo[CT ICollection](flowName string, meta *taskMeta[CT]) TaskInfo {
+	return TaskInfo{
+		FlowName:      flowName,
+		Name:          meta.Name,
+		InputTypes:    meta.inputList,
+		OutputType:    meta.OutputType,
+		Timeout:       meta.Timeout,
+		ResourceClass: meta.ResourceClass,
+	}
+}
+
+// chainInterceptors wraps handler with interceptors, the first interceptor is the outermost
+func chainInterceptors[CT ICollection](
+	info TaskInfo, interceptors []Interceptor[CT], handler TaskHandler[CT],
+) TaskHandler[CT] {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], handler
+		handler = func(ctx context.Context, collection CT) error {
+			return interceptor(ctx, info, collection, next)
+		}
+	}
+	return handler
+}
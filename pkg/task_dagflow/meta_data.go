@@ -3,55 +3,42 @@ package task_dagflow
 import (
 	"errors"
 	"reflect"
+	"sort"
 	"time"
 
 	mapset "github.com/deckarep/golang-set/v2"
 )
 
-type collectionMeta[CT ICollection] struct {
-	InputTypes mapset.Set[reflect.Type]
-	// AvailableTypes mapset.Set[reflect.Type]
-	TargetTypes mapset.Set[reflect.Type]
-}
-
-func newCollectionMeta[CT ICollection](collection CT) (*collectionMeta[CT], error) {
-	// nil is valid type for inputs and available
-	inputs := mapset.NewSet[reflect.Type]()
-	inputs.Append(collection.InputTypes()...)
-	inputs.Add(nil)
-	// available := mapset.NewSet[reflect.Type]()
-	// available.Append(collection.AvailableTypes()...)
-	// available.Add(nil)
-	// outputs remove nil, though nil is valid
-	targets := mapset.NewSet[reflect.Type]()
-	targets.Append(collection.TargetTypes()...)
-	targets.Remove(nil)
-	// Validate the collection metadata
-	if targets.IsEmpty() {
-		return nil, errors.New("task flow must produce at least one output type")
-	}
-	// if !available.IsSuperset(inputs) {
-	// 	return nil, errors.New("task flow inputs must be a subset of available types")
-	// }
-	// if !available.IsSuperset(targets) {
-	// 	return nil, errors.New("task flow outputs must be a subset of available types")
-	// }
-	return &collectionMeta[CT]{
-		InputTypes: inputs,
-		// AvailableTypes: available,
-		TargetTypes: targets,
-	}, nil
-}
-
 type taskMeta[CT ICollection] struct {
-	CreateFunc TaskCreateFunc[CT]
-	Name       string
-	InputTypes mapset.Set[reflect.Type]
-	OutputType reflect.Type
-	Timeout    time.Duration
+	CreateFunc   TaskCreateFunc[CT]
+	Name         string
+	InputTypes   mapset.Set[reflect.Type]
+	OutputType   reflect.Type
+	Timeout      time.Duration
+	Interceptors []Interceptor[CT]
+	// Fallbacks produce the same output when the primary task fails or times out
+	Fallbacks []*taskMeta[CT]
+	// HedgeDelay of a fallback: start it after this delay if the previous producer is still running
+	HedgeDelay time.Duration
+	// IsVariant: the task is one of several variants producing the output, see RegisterVariantTasks
+	IsVariant bool
+	// ResourceClass limits running tasks of the class in the process, see WithResourceClass
+	ResourceClass string
+	// Compensation undoes the task when the run fails, see WithCompensation
+	Compensation Compensation[CT]
+	// stateless is the task created at registration if it is an IStatelessTask, shared by all flows
+	stateless ITask[CT]
+	// producers are the producers of the task and its fallbacks shared by all flows of the snapshot,
+	// set by newSnapshot when all of them are stateless
+	producers []*taskProducer[CT]
+	// inputList is InputTypes without nil, sorted by name
+	inputList []reflect.Type
+	// outputID and inputIDs index the task's types in the graph of its snapshot, set by newGraph
+	outputID int32
+	inputIDs []int32
 }
 
-func newTaskMeta[CT ICollection](createFunc TaskCreateFunc[CT]) (*taskMeta[CT], error) {
+func newTaskMeta[CT ICollection](createFunc TaskCreateFunc[CT], options ...TaskOption[CT]) (*taskMeta[CT], error) {
 	task, err := CreateTask(createFunc)
 	if err != nil {
 		return nil, err
@@ -69,11 +56,42 @@ func newTaskMeta[CT ICollection](createFunc TaskCreateFunc[CT]) (*taskMeta[CT],
 		return nil, errors.New("task output type cannot be one of the input types")
 	}
 
-	return &taskMeta[CT]{
+	inputList := make([]reflect.Type, 0, inputs.Cardinality())
+	for _, inputType := range inputs.ToSlice() {
+		if inputType != nil {
+			inputList = append(inputList, inputType)
+		}
+	}
+	sort.Slice(inputList, func(i, j int) bool {
+		return inputList[i].String() < inputList[j].String()
+	})
+
+	meta := &taskMeta[CT]{
 		CreateFunc: createFunc,
 		Name:       task.Name(),
 		InputTypes: inputs,
 		OutputType: outputType,
 		Timeout:    task.Timeout(),
-	}, nil
+		inputList:  inputList,
+	}
+	if stateless, ok := task.(IStatelessTask); ok && stateless.Stateless() {
+		meta.stateless = task
+	}
+	for _, option := range options {
+		option(meta)
+	}
+	return meta, nil
+}
+
+// clone copies the meta so later registrations never change a built snapshot,
+// the input set is shared since it is never modified after creation
+func (m *taskMeta[CT]) clone() *taskMeta[CT] {
+	cloned := *m
+	cloned.producers = nil
+	cloned.Interceptors = append([]Interceptor[CT](nil), m.Interceptors...)
+	cloned.Fallbacks = make([]*taskMeta[CT], 0, len(m.Fallbacks))
+	for _, fallback := range m.Fallbacks {
+		cloned.Fallbacks = append(cloned.Fallbacks, fallback.clone())
+	}
+	return &cloned
 }
@@ -0,0 +1,89 @@
+package task_dagflow
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"time"
+)
+
+// Recompute re-executes only the tasks transitively downstream of the changed types, after the caller
+// updated those values in the collection, and keeps the outputs of all other tasks from the last execution.
+// Tasks which did not succeed in the last execution or were compensated run again too,
+// so without one Recompute is Execute.
+//
+// Changed types are collection inputs or task outputs overridden by the caller: the producer of a changed
+// type never runs, even when it is downstream of another change. Kept tasks are reported as TaskStatusReused.
+func (t *TaskDagflow[CT]) Recompute(ctx context.Context, timeout time.Duration, changed ...reflect.Type) error {
+	return t.run(ctx, func(ctx context.Context, recorder *runRecorder[CT]) error {
+		// run holds the lock, t.report is still the report of the last execution
+		waits := t.recomputeWaits(changed)
+		for i, wait := range waits {
+			if wait < 0 {
+				// without a last execution only overridden outputs are kept
+				producer := t.tasks[i].Meta.Name
+				if t.report != nil {
+					producer = t.report.Tasks[i].Producer
+				}
+				recorder.TaskReused(int32(i), producer)
+			}
+		}
+		if t.sequential {
+			return t.executeSequential(ctx, timeout, recorder, nil, waits)
+		}
+		return t.execute(ctx, timeout, recorder, waits)
+	})
+}
+
+// produced reports whether the collection holds the task's output after the run
+func (s TaskStatus) produced() bool {
+	return s == TaskStatusSuccess || s == TaskStatusReused
+}
+
+// recomputeWaits returns the waits of the tasks to run again, -1 for tasks whose output is reused
+func (t *TaskDagflow[CT]) recomputeWaits(changed []reflect.Type) []int32 {
+	dirty := make([]bool, len(t.tasks))
+	queue := make([]int32, 0, len(t.tasks))
+	mark := func(i int32) {
+		if !dirty[i] {
+			dirty[i] = true
+			queue = append(queue, i)
+		}
+	}
+	for i, task := range t.tasks {
+		// a compensated output was undone, e.g. its reservation canceled
+		if t.report == nil || !t.report.Tasks[i].Status.produced() || t.report.Tasks[i].Compensated ||
+			task.Meta.InputTypes.ContainsAny(changed...) {
+			mark(int32(i))
+		}
+	}
+	for len(queue) > 0 {
+		i := queue[0]
+		queue = queue[1:]
+		for _, dependent := range t.plan.Dependents(i) {
+			mark(dependent)
+		}
+	}
+	for i, task := range t.tasks {
+		if slices.Contains(changed, task.Meta.OutputType) {
+			dirty[i] = false
+		}
+	}
+
+	// inputs produced by reused tasks are ready
+	waits := slices.Clone(t.plan.waits)
+	for i := range t.tasks {
+		if dirty[i] {
+			continue
+		}
+		for _, dependent := range t.plan.Dependents(int32(i)) {
+			waits[dependent]--
+		}
+	}
+	for i := range waits {
+		if !dirty[i] {
+			waits[i] = -1
+		}
+	}
+	return waits
+}
@@ -0,0 +1,212 @@
+package task_dagflow
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+type RunStatus string
+
+const (
+	RunStatusSuccess RunStatus = "success"
+	RunStatusFailed  RunStatus = "failed"
+)
+
+type TaskStatus string
+
+const (
+	TaskStatusSuccess TaskStatus = "success"
+	TaskStatusFailed  TaskStatus = "failed"
+	// TaskStatusUnfinished: task was started but the flow ended before it returned
+	TaskStatusUnfinished TaskStatus = "unfinished"
+	// TaskStatusSkipped: task was never started, its inputs were not ready when the flow ended
+	TaskStatusSkipped TaskStatus = "skipped"
+	// TaskStatusReused: task did not run in a Recompute, its output of the previous run was kept
+	TaskStatusReused TaskStatus = "reused"
+)
+
+// TaskReport records the execution of one task in a run
+type TaskReport struct {
+	Name       string     `json:"name"`
+	OutputType string     `json:"output_type"`
+	Status     TaskStatus `json:"status"`
+	// Producer is the name of the task which supplied the value: the primary task or a fallback
+	Producer  string        `json:"producer,omitempty"`
+	StartTime time.Time     `json:"start_time,omitempty"`
+	TimeCost  time.Duration `json:"time_cost"`
+	Error     string        `json:"error,omitempty"`
+	// TimedOut is set when the task failed because its deadline was exceeded
+	TimedOut bool `json:"timed_out,omitempty"`
+	// Compensated is set when the compensation of the task was called, see WithCompensation
+	Compensated       bool   `json:"compensated,omitempty"`
+	CompensationError string `json:"compensation_error,omitempty"`
+	// Reads and Writes are the collection value types the task accessed, only recorded in checked mode
+	Reads  []string `json:"reads,omitempty"`
+	Writes []string `json:"writes,omitempty"`
+}
+
+// RunReport records one execution of a TaskDagflow
+type RunReport struct {
+	FlowName string `json:"flow_name"`
+	RunID    string `json:"run_id,omitempty"`
+	// RequestID is set by WithRequestID on the ctx passed to Execute
+	RequestID string `json:"request_id,omitempty"`
+	// Collection is the summary of the collection, only set if it implements ICollectionSummary
+	Collection string `json:"collection,omitempty"`
+	// GraphVersion is the version of the snapshot the flow was created from
+	GraphVersion uint64        `json:"graph_version,omitempty"`
+	Status       RunStatus     `json:"status"`
+	StartTime    time.Time     `json:"start_time"`
+	TimeCost     time.Duration `json:"time_cost"`
+	Error        string        `json:"error,omitempty"`
+	Tasks        []TaskReport  `json:"tasks"`
+}
+
+// FailedTasks returns reports of tasks which failed in the run
+func (r *RunReport) FailedTasks() []TaskReport {
+	failed := make([]TaskReport, 0)
+	for _, task := range r.Tasks {
+		if task.Status == TaskStatusFailed {
+			failed = append(failed, task)
+		}
+	}
+	return failed
+}
+
+// attachAccesses fills task reports with accesses recorded in checked mode
+func (r *RunReport) attachAccesses(accesses map[string]TaskAccess) {
+	for i := range r.Tasks {
+		name := r.Tasks[i].Producer
+		if name == "" {
+			name = r.Tasks[i].Name
+		}
+		access, ok := accesses[name]
+		if !ok {
+			continue
+		}
+		for _, readType := range access.Reads {
+			r.Tasks[i].Reads = append(r.Tasks[i].Reads, typeName(readType))
+		}
+		for _, writeType := range access.Writes {
+			r.Tasks[i].Writes = append(r.Tasks[i].Writes, typeName(writeType))
+		}
+	}
+}
+
+// ICollectionSummary is implemented by collections describing their run in reports,
+// e.g. with the request parameters. Summary is called after the run.
+type ICollectionSummary interface {
+	Summary() string
+}
+
+// RunObserver is called with the report after each execution of flows created by a factory
+type RunObserver func(report *RunReport)
+
+// RunStart describes an execution about to start
+type RunStart struct {
+	FlowName     string
+	GraphVersion uint64
+	RunID        string
+	RequestID    string
+	StartTime    time.Time
+	// TaskCount is the number of tasks planned, fallbacks excluded
+	TaskCount int
+}
+
+// RunStartObserver is called before each execution of flows created by a factory, ctx is the ctx of the run
+type RunStartObserver func(ctx context.Context, start RunStart)
+
+// runObservers are the observers of a factory when a flow is created
+type runObservers struct {
+	Start  []RunStartObserver
+	Finish []RunObserver
+}
+
+// runRecorder collects task reports during one execution, reports[i] belongs to task i of the flow plan
+type runRecorder[CT ICollection] struct {
+	flowName     string
+	graphVersion uint64
+	runID        string
+	startTime    time.Time
+	reports      []TaskReport
+	// succeeded are the indexes of tasks which succeeded, in completion order
+	succeeded []int32
+}
+
+func newRunRecorder[CT ICollection](
+	flowName string, graphVersion uint64, runID string, tasks []*taskExecutor[CT], startTime time.Time,
+) *runRecorder[CT] {
+	r := &runRecorder[CT]{
+		flowName:     flowName,
+		graphVersion: graphVersion,
+		runID:        runID,
+		startTime:    startTime,
+		reports:      make([]TaskReport, len(tasks)),
+	}
+	for i, task := range tasks {
+		r.reports[i] = TaskReport{
+			Name:       task.Meta.Name,
+			OutputType: typeName(task.Meta.OutputType),
+			Status:     TaskStatusSkipped,
+		}
+	}
+	return r
+}
+
+func (r *runRecorder[CT]) TaskStarted(index int32, startTime time.Time) {
+	r.reports[index].Status = TaskStatusUnfinished
+	r.reports[index].StartTime = startTime
+}
+
+func (r *runRecorder[CT]) TaskReused(index int32, producer string) {
+	r.reports[index].Status = TaskStatusReused
+	r.reports[index].Producer = producer
+}
+
+func (r *runRecorder[CT]) TaskFinished(result taskResult[CT]) {
+	report := &r.reports[result.Index]
+	report.TimeCost = result.TimeCost
+	report.Producer = result.Producer
+	if result.Err != nil {
+		report.Status = TaskStatusFailed
+		report.Error = result.Err.Error()
+		report.TimedOut = errors.Is(result.Err, context.DeadlineExceeded)
+	} else {
+		report.Status = TaskStatusSuccess
+		r.succeeded = append(r.succeeded, result.Index)
+	}
+}
+
+func (r *runRecorder[CT]) Succeeded() []int32 {
+	return r.succeeded
+}
+
+func (r *runRecorder[CT]) TaskCompensated(index int32, err error) {
+	r.reports[index].Compensated = true
+	if err != nil {
+		r.reports[index].CompensationError = err.Error()
+	}
+}
+
+func (r *runRecorder[CT]) Finish(timeCost time.Duration, err error) *RunReport {
+	report := &RunReport{
+		FlowName:     r.flowName,
+		RunID:        r.runID,
+		GraphVersion: r.graphVersion,
+		Status:       RunStatusSuccess,
+		StartTime:    r.startTime,
+		TimeCost:     timeCost,
+		Tasks:        r.reports,
+	}
+	if err != nil {
+		report.Status = RunStatusFailed
+		report.Error = err.Error()
+	}
+	for i := range report.Tasks {
+		if report.Tasks[i].Status == TaskStatusUnfinished {
+			report.Tasks[i].TimeCost = r.startTime.Add(timeCost).Sub(report.Tasks[i].StartTime)
+		}
+	}
+	return report
+}
@@ -0,0 +1,157 @@
+package task_dagflow
+
+import (
+	"container/list"
+	"context"
+	"sort"
+	"sync"
+)
+
+// ResourceStats describes the usage of a resource class in the process
+type ResourceStats struct {
+	Class string `json:"class"`
+	// Limit is the maximum number of running tasks of the class, unlimited if <= 0
+	Limit   int `json:"limit"`
+	Running int `json:"running"`
+	Waiting int `json:"waiting"`
+}
+
+// WithResourceClass declares the scarce backend used by the task, e.g. "mysql" or "search-rpc":
+// tasks of the class wait for a slot when SetResourceLimit is reached.
+// Waiting counts against the task timeout and happens before interceptors run.
+func WithResourceClass[CT ICollection](class string) TaskOption[CT] {
+	return func(meta *taskMeta[CT]) {
+		meta.ResourceClass = class
+	}
+}
+
+// SetResourceLimit limits the number of tasks of the class running at the same time, shared by all flows
+// of all factories in the process. limit <= 0 removes the limit, waiting tasks see a new limit at once.
+func SetResourceLimit(class string, limit int) {
+	resources.Limiter(class).SetLimit(limit)
+}
+
+// GetResourceStats returns the usage of every resource class used or limited so far, sorted by class
+func GetResourceStats() []ResourceStats {
+	return resources.Stats()
+}
+
+var resources = &resourceRegistry{limiters: make(map[string]*resourceLimiter)}
+
+type resourceRegistry struct {
+	lock     sync.Mutex
+	limiters map[string]*resourceLimiter
+}
+
+func (r *resourceRegistry) Limiter(class string) *resourceLimiter {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	limiter, ok := r.limiters[class]
+	if !ok {
+		limiter = &resourceLimiter{class: class}
+		r.limiters[class] = limiter
+	}
+	return limiter
+}
+
+func (r *resourceRegistry) Stats() []ResourceStats {
+	r.lock.Lock()
+	limiters := make([]*resourceLimiter, 0, len(r.limiters))
+	for _, limiter := range r.limiters {
+		limiters = append(limiters, limiter)
+	}
+	r.lock.Unlock()
+
+	stats := make([]ResourceStats, 0, len(limiters))
+	for _, limiter := range limiters {
+		stats = append(stats, limiter.Stats())
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Class < stats[j].Class
+	})
+	return stats
+}
+
+// resourceLimiter is a resizable semaphore, slots are granted to waiting tasks in arrival order
+type resourceLimiter struct {
+	class   string
+	lock    sync.Mutex
+	limit   int
+	running int
+	// waiters are channels closed when the slot is granted
+	waiters list.List
+}
+
+func (l *resourceLimiter) Acquire(ctx context.Context) error {
+	l.lock.Lock()
+	if l.waiters.Len() == 0 && l.available() {
+		l.running++
+		l.lock.Unlock()
+		return nil
+	}
+	granted := make(chan struct{})
+	waiter := l.waiters.PushBack(granted)
+	l.lock.Unlock()
+
+	select {
+	case <-granted:
+		return nil
+	case <-ctx.Done():
+	}
+	l.lock.Lock()
+	select {
+	case <-granted:
+		// granted while giving up, pass the slot on
+		l.lock.Unlock()
+		l.Release()
+	default:
+		l.waiters.Remove(waiter)
+		l.lock.Unlock()
+	}
+	return ctx.Err()
+}
+
+func (l *resourceLimiter) Release() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.running--
+	l.grant()
+}
+
+func (l *resourceLimiter) SetLimit(limit int) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.limit = limit
+	l.grant()
+}
+
+func (l *resourceLimiter) Stats() ResourceStats {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return ResourceStats{Class: l.class, Limit: l.limit, Running: l.running, Waiting: l.waiters.Len()}
+}
+
+func (l *resourceLimiter) available() bool {
+	return l.limit <= 0 || l.running < l.limit
+}
+
+// grant must be called with the lock held
+func (l *resourceLimiter) grant() {
+	for l.waiters.Len() > 0 && l.available() {
+		waiter := l.waiters.Front()
+		l.waiters.Remove(waiter)
+		l.running++
+		close(waiter.Value.(chan struct{}))
+	}
+}
+
+// resourceHandler holds a slot of the limiter while handler runs
+func resourceHandler[CT ICollection](limiter *resourceLimiter, handler TaskHandler[CT]) TaskHandler[CT] {
+	return func(ctx context.Context, collection CT) error {
+		if err := limiter.Acquire(ctx); err != nil {
+			return err
+		}
+		defer limiter.Release()
+		return handler(ctx, collection)
+	}
+}
@@ -0,0 +1,143 @@
+package task_dagflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"time"
+)
+
+type StepPhase string
+
+const (
+	StepBefore StepPhase = "before"
+	StepAfter  StepPhase = "after"
+)
+
+// Step describes a task in a sequential run, the hook sees it before and after the task runs
+type Step struct {
+	// Index counts tasks started in this run, starting from 0
+	Index      int
+	Phase      StepPhase
+	Task       string
+	OutputType reflect.Type
+	// Ready are the other tasks ready to run, in the order they will run
+	Ready []string
+	// Producer and Err are the result of the task, only set in StepAfter
+	Producer string
+	Err      error
+}
+
+// StepHook is called around every task of ExecuteSequential on the caller's goroutine,
+// a good place for a breakpoint. Returning an error stops the run with that error.
+type StepHook func(ctx context.Context, step Step) error
+
+// ExecuteSequential runs ready tasks one at a time on the caller's goroutine, in a stable topological
+// order: among ready tasks the one with the smallest name runs first. Runs of the same flow with the same
+// collection are identical, which makes bugs reproducible and debuggable with breakpoints.
+//
+// Timeouts are passed to tasks through ctx, a task ignoring ctx delays the whole run.
+// Fallbacks run one after another, hedging is disabled. hook may be nil.
+func (t *TaskDagflow[CT]) ExecuteSequential(ctx context.Context, timeout time.Duration, hook StepHook) error {
+	return t.run(ctx, func(ctx context.Context, recorder *runRecorder[CT]) error {
+		return t.executeSequential(ctx, timeout, recorder, hook, slices.Clone(t.plan.waits))
+	})
+}
+
+func (t *TaskDagflow[CT]) executeSequential(
+	ctx context.Context, timeout time.Duration, recorder *runRecorder[CT], hook StepHook, waits []int32,
+) error {
+	flowCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ready := make([]*taskExecutor[CT], 0, len(t.tasks))
+	push := func(task *taskExecutor[CT]) {
+		// keep ready sorted by name, equal names keep their plan order
+		i := sort.Search(len(ready), func(i int) bool { return ready[i].Meta.Name > task.Meta.Name })
+		ready = slices.Insert(ready, i, task)
+	}
+	for i, task := range t.tasks {
+		if waits[i] == 0 {
+			push(task)
+		}
+	}
+
+	for index := 0; len(ready) > 0; index++ {
+		if err := flowCtx.Err(); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return &FlowTimeoutError{FlowName: t.name, Timeout: timeout}
+		}
+		task := ready[0]
+		ready = ready[1:]
+		step := Step{Index: index, Phase: StepBefore, Task: task.Meta.Name, OutputType: task.Meta.OutputType}
+		if hook != nil {
+			for _, other := range ready {
+				step.Ready = append(step.Ready, other.Meta.Name)
+			}
+			if err := hook(flowCtx, step); err != nil {
+				return err
+			}
+		}
+
+		startTime := time.Now()
+		recorder.TaskStarted(task.Index, startTime)
+		producer, err := task.produceSequential(flowCtx, t.collection)
+		recorder.TaskFinished(taskResult[CT]{
+			Index: task.Index, Meta: task.Meta, Producer: producer, TimeCost: time.Since(startTime), Err: err,
+		})
+
+		if hook != nil {
+			step.Phase, step.Producer, step.Err = StepAfter, producer, err
+			if hookErr := hook(flowCtx, step); hookErr != nil {
+				return hookErr
+			}
+		}
+		if err != nil {
+			return &TaskError{TaskName: task.Meta.Name, OutputType: task.Meta.OutputType, Err: err}
+		}
+		for _, dependent := range t.plan.Dependents(task.Index) {
+			waits[dependent]--
+			if waits[dependent] == 0 {
+				push(t.tasks[dependent])
+			}
+		}
+	}
+	return nil
+}
+
+// produceSequential runs the primary task then fallbacks one after another, the first success wins
+func (te *taskExecutor[CT]) produceSequential(ctx context.Context, collection CT) (string, error) {
+	if len(te.Producers) == 1 {
+		return te.Producers[0].Meta.Name, te.Producers[0].executeInline(ctx, collection)
+	}
+	errs := make([]error, 0, len(te.Producers))
+	for _, producer := range te.Producers {
+		err := producer.executeInline(ctx, collection)
+		if err == nil {
+			return producer.Meta.Name, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", producer.Meta.Name, err))
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return "", errors.Join(errs...)
+}
+
+// executeInline runs the task on the caller's goroutine, a task returning after its timeout
+// is reported as timed out just like in Execute
+func (tp *taskProducer[CT]) executeInline(ctx context.Context, collection CT) (err error) {
+	subCtx, cancel := context.WithTimeout(tp.withMetadata(ctx), tp.Meta.Timeout)
+	defer cancel()
+	defer tp.recoverPanic(&err)
+
+	if err := tp.Handler(subCtx, collection); err != nil {
+		return tp.wrapTimeout(ctx, err)
+	}
+	return tp.wrapTimeout(ctx, subCtx.Err())
+}
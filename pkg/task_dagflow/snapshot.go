@@ -0,0 +1,87 @@
+package task_dagflow
+
+import (
+	"time"
+)
+
+// Snapshot is an immutable, versioned graph built by Factory.CreateGraph or Factory.Reload.
+// Registrations made after it was built never change it, so it is safe to share between goroutines.
+type Snapshot[CT ICollection] struct {
+	name          string
+	version       uint64
+	checkContract bool
+	sequential    bool
+	createTime    time.Time
+	tasks         *TaskSet[CT]
+	graph         *graph[CT]
+	interceptors  []Interceptor[CT]
+	observers     func() runObservers
+}
+
+func newSnapshot[CT ICollection](
+	config Config, version uint64, tasks *TaskSet[CT],
+	interceptors []Interceptor[CT], observers func() runObservers,
+) *Snapshot[CT] {
+	tasks = tasks.clone()
+	variants := make([]*variantGroup[CT], 0, len(tasks.outputToVariants))
+	for _, group := range tasks.outputToVariants {
+		variants = append(variants, group)
+	}
+	metas := make([]*taskMeta[CT], 0, len(tasks.outputToTaskMeta))
+	for _, meta := range tasks.outputToTaskMeta {
+		metas = append(metas, meta)
+	}
+	snapshot := &Snapshot[CT]{
+		name:          config.Name,
+		version:       version,
+		checkContract: config.CheckContract,
+		sequential:    config.Sequential,
+		createTime:    time.Now(),
+		tasks:         tasks,
+		graph:         newGraph(metas, variants),
+		interceptors:  append([]Interceptor[CT](nil), interceptors...),
+		observers:     observers,
+	}
+	// checked mode wraps every task with the tracker of its flow, nothing is shared
+	if !config.CheckContract {
+		producerConfig := flowConfig[CT]{Name: snapshot.name, Interceptors: snapshot.interceptors}
+		for _, meta := range tasks.metas() {
+			meta.producers = newSharedProducers(producerConfig, meta)
+		}
+	}
+	return snapshot
+}
+
+// Version increases by one each time the factory builds a snapshot, starting from 1
+func (s *Snapshot[CT]) Version() uint64 {
+	return s.version
+}
+
+func (s *Snapshot[CT]) CreateTime() time.Time {
+	return s.createTime
+}
+
+func (s *Snapshot[CT]) GraphSpec() GraphSpec {
+	spec := newGraphSpec(s.name, s.tasks.metas())
+	spec.Version = s.version
+	return spec
+}
+
+func (s *Snapshot[CT]) CreateTaskDagflow(collection CT) (*TaskDagflow[CT], error) {
+	plan, err := s.graph.Plan(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	config := flowConfig[CT]{
+		Name:          s.name,
+		Version:       s.version,
+		Interceptors:  s.interceptors,
+		CheckContract: s.checkContract,
+		Sequential:    s.sequential,
+	}
+	if s.observers != nil {
+		config.Observers = s.observers()
+	}
+	return newTaskDagflow(config, plan, collection)
+}
@@ -0,0 +1,88 @@
+package task_dagflow
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TaskSpec is the exported, serializable description of a registered task
+type TaskSpec struct {
+	Name       string        `json:"name"`
+	InputTypes []string      `json:"input_types"`
+	OutputType string        `json:"output_type"`
+	Timeout    time.Duration `json:"timeout"`
+	// Variant: one of several tasks producing the output, selected per collection
+	Variant       bool   `json:"variant,omitempty"`
+	ResourceClass string `json:"resource_class,omitempty"`
+	// Compensation: the task declares a compensation, see WithCompensation
+	Compensation bool       `json:"compensation,omitempty"`
+	Fallbacks    []TaskSpec `json:"fallbacks,omitempty"`
+}
+
+// GraphSpec is the exported, serializable description of a factory's task graph
+type GraphSpec struct {
+	Name string `json:"name"`
+	// Version of the snapshot, 0 for registrations not built into a snapshot
+	Version uint64     `json:"version,omitempty"`
+	Tasks   []TaskSpec `json:"tasks"`
+}
+
+func typeName(t reflect.Type) string {
+	if t == nil {
+		return "<nil>"
+	}
+	return t.String()
+}
+
+func newTaskSpec[CT ICollection](meta *taskMeta[CT]) TaskSpec {
+	inputs := make([]string, 0, meta.InputTypes.Cardinality())
+	for inputType := range meta.InputTypes.Iter() {
+		if inputType != nil {
+			inputs = append(inputs, typeName(inputType))
+		}
+	}
+	sort.Strings(inputs)
+	spec := TaskSpec{
+		Name:          meta.Name,
+		InputTypes:    inputs,
+		OutputType:    typeName(meta.OutputType),
+		Timeout:       meta.Timeout,
+		Variant:       meta.IsVariant,
+		ResourceClass: meta.ResourceClass,
+		Compensation:  meta.Compensation != nil,
+	}
+	for _, fallback := range meta.Fallbacks {
+		spec.Fallbacks = append(spec.Fallbacks, newTaskSpec(fallback))
+	}
+	return spec
+}
+
+func newGraphSpec[CT ICollection](name string, metas []*taskMeta[CT]) GraphSpec {
+	tasks := make([]TaskSpec, 0, len(metas))
+	for _, meta := range metas {
+		tasks = append(tasks, newTaskSpec(meta))
+	}
+	sort.Slice(tasks, func(i, j int) bool {
+		return tasks[i].Name < tasks[j].Name
+	})
+	return GraphSpec{Name: name, Tasks: tasks}
+}
+
+// DOT renders the graph in graphviz dot format: tasks are boxes, data types are ellipses
+func (s GraphSpec) DOT() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "digraph %q {\n", s.Name)
+	b.WriteString("  rankdir=LR;\n")
+	for _, task := range s.Tasks {
+		fmt.Fprintf(&b, "  %q [shape=box, label=%q];\n", "task:"+task.Name, task.Name)
+		for _, input := range task.InputTypes {
+			fmt.Fprintf(&b, "  %q -> %q;\n", input, "task:"+task.Name)
+		}
+		fmt.Fprintf(&b, "  %q -> %q;\n", "task:"+task.Name, task.OutputType)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
@@ -2,7 +2,6 @@ package task_dagflow
 
 import (
 	"context"
-	"fmt"
 	"reflect"
 	"strings"
 	"time"
@@ -43,6 +42,13 @@ type ITask[CT ICollection] interface {
 	Execute(ctx context.Context, collection CT) error
 }
 
+// IStatelessTask is optionally implemented by tasks keeping no state between runs, such as FuncTask and TypedTask.
+// A stateless task is created once at registration and shared by all flows of a snapshot,
+// instead of calling its TaskCreateFunc for every flow. Stateless tasks must be concurrent-safe.
+type IStatelessTask interface {
+	Stateless() bool
+}
+
 type TaskCreateFunc[CT ICollection] func() (ITask[CT], error)
 
 func CreateTask[CT ICollection](createFunc TaskCreateFunc[CT]) (ITask[CT], error) {
@@ -51,11 +57,16 @@ func CreateTask[CT ICollection](createFunc TaskCreateFunc[CT]) (ITask[CT], error
 		return nil, err
 	}
 	if task == nil {
-		return nil, fmt.Errorf("task created with %T returned nil", createFunc)
+		// the task's name is unknown until it is created, callers knowing it fill it in
+		return nil, &NilResultError{}
 	}
 	return task, nil
 }
 
+// AutoInputTypes returns result types of all Get* methods of CT.
+//
+// Deprecated: it depends on method names and CT declaring only the task's inputs,
+// use NewFuncTask which derives input types from a function signature.
 func AutoInputTypes[CT ICollection]() []reflect.Type {
 	cElem := reflect.TypeOf((*CT)(nil)).Elem()
 	var inputTypes []reflect.Type
@@ -68,6 +79,10 @@ func AutoInputTypes[CT ICollection]() []reflect.Type {
 	return inputTypes
 }
 
+// AutoOutputType returns the parameter type of the first Set* method of CT.
+//
+// Deprecated: it depends on method names and method order, use NewFuncTask
+// which derives the output type from a function signature.
 func AutoOutputType[CT ICollection]() reflect.Type {
 	cElem := reflect.TypeOf((*CT)(nil)).Elem()
 	for i := 0; i < cElem.NumMethod(); i++ {
@@ -2,111 +2,197 @@ package task_dagflow
 
 import (
 	"context"
-	"errors"
 	"fmt"
-	"reflect"
+	"slices"
 	"sync"
 	"time"
-
-	mapset "github.com/deckarep/golang-set/v2"
 )
 
+// flowConfig is what a snapshot hands to the flows it creates
+type flowConfig[CT ICollection] struct {
+	Name          string
+	Version       uint64
+	Interceptors  []Interceptor[CT]
+	Observers     runObservers
+	CheckContract bool
+	Sequential    bool
+}
+
 type TaskDagflow[CT ICollection] struct {
-	collection     CT
-	collectionMeta *collectionMeta[CT]
+	name       string
+	version    uint64
+	collection CT
 
-	metas        []*taskMeta[CT]
-	tasks        []*taskExecutor[CT]
-	inputToTasks map[reflect.Type][]*taskExecutor[CT]
-	timeCost     time.Duration
+	plan       *flowPlan[CT]
+	tasks      []*taskExecutor[CT]
+	timeCost   time.Duration
+	report     *RunReport
+	observers  runObservers
+	tracker    *AccessTracker
+	sequential bool
+	// compensable is set when a producer of the flow declares a compensation
+	compensable bool
 
 	lock sync.Mutex
 }
 
 func NewTaskDagflow[CT ICollection](metas []*taskMeta[CT], collection CT) (*TaskDagflow[CT], error) {
-	collectionMeta, err := newCollectionMeta(collection)
+	g := newGraph(metas, nil)
+	provided, _, err := g.collectionTypes(collection)
 	if err != nil {
 		return nil, err
 	}
+	return newTaskDagflow(flowConfig[CT]{Name: GetDefaultConfig().Name}, g.newFlowPlan(metas, provided), collection)
+}
 
-	tasks := make([]*taskExecutor[CT], 0, len(metas))
-	for _, meta := range metas {
-		task, err := newTaskExecutor(meta)
-		if err != nil {
-			return nil, err
+func newTaskDagflow[CT ICollection](
+	config flowConfig[CT], plan *flowPlan[CT], collection CT,
+) (*TaskDagflow[CT], error) {
+	var tracker *AccessTracker
+	if config.CheckContract {
+		tracked, ok := any(collection).(IAccessTracked)
+		if !ok {
+			return nil, fmt.Errorf("checked mode requires collection %T to embed task_dagflow.AccessTracker", collection)
 		}
-		tasks = append(tasks, task)
+		tracker = tracked.accessTracker()
 	}
-	inputToTasks := make(map[reflect.Type][]*taskExecutor[CT], 0)
-	for _, task := range tasks {
-		for inputType := range task.Meta.InputTypes.Iter() {
-			inputToTasks[inputType] = append(inputToTasks[inputType], task)
+
+	// executors are allocated at once, tasks point into them
+	executors := make([]taskExecutor[CT], len(plan.metas))
+	tasks := make([]*taskExecutor[CT], len(plan.metas))
+	compensable := false
+	for i, meta := range plan.metas {
+		var err error
+		if executors[i], err = newTaskExecutor(config, int32(i), meta, tracker); err != nil {
+			return nil, err
+		}
+		tasks[i] = &executors[i]
+		for _, producer := range tasks[i].Producers {
+			compensable = compensable || producer.Meta.Compensation != nil
 		}
 	}
 	return &TaskDagflow[CT]{
-		collection:     collection,
-		collectionMeta: collectionMeta,
+		name:       config.Name,
+		version:    config.Version,
+		collection: collection,
 
-		metas:        metas,
-		tasks:        tasks,
-		inputToTasks: inputToTasks,
-		timeCost:     0,
+		plan:        plan,
+		tasks:       tasks,
+		timeCost:    0,
+		observers:   config.Observers,
+		tracker:     tracker,
+		sequential:  config.Sequential,
+		compensable: compensable,
 
 		lock: sync.Mutex{},
 	}, nil
 }
 
-func (t *TaskDagflow[CT]) initUnblockTypeChan(collectionMeta *collectionMeta[CT]) chan reflect.Type {
-	unblockTypeChan := make(chan reflect.Type, len(t.metas)+2) // +2 for nil: ensure no-chan-block
-	unblockTypeChan <- nil
-	for initType := range collectionMeta.InputTypes.Iter() {
-		unblockTypeChan <- initType
+func (t *TaskDagflow[CT]) Execute(ctx context.Context, timeout time.Duration) error {
+	if t.sequential {
+		return t.ExecuteSequential(ctx, timeout, nil)
 	}
-	return unblockTypeChan
+	return t.run(ctx, func(ctx context.Context, recorder *runRecorder[CT]) error {
+		return t.execute(ctx, timeout, recorder, slices.Clone(t.plan.waits))
+	})
 }
 
-func (t *TaskDagflow[CT]) Execute(ctx context.Context, timeout time.Duration) error {
+// run executes the flow with executeFunc and publishes the report, ctx carries the run id
+func (t *TaskDagflow[CT]) run(
+	ctx context.Context, executeFunc func(ctx context.Context, recorder *runRecorder[CT]) error,
+) error {
 	t.lock.Lock()
 	defer t.lock.Unlock()
 
+	ctx, runID := withRunID(ctx)
 	startTime := time.Now()
+	if len(t.observers.Start) > 0 {
+		start := RunStart{
+			FlowName:     t.name,
+			GraphVersion: t.version,
+			RunID:        runID,
+			RequestID:    RequestIDFromContext(ctx),
+			StartTime:    startTime,
+			TaskCount:    len(t.tasks),
+		}
+		for _, observer := range t.observers.Start {
+			observer(ctx, start)
+		}
+	}
+	recorder := newRunRecorder(t.name, t.version, runID, t.tasks, startTime)
+	err := executeFunc(ctx, recorder)
+	if err != nil {
+		err = t.compensate(ctx, recorder, err)
+	}
+	t.timeCost = time.Since(startTime)
+	t.report = recorder.Finish(t.timeCost, err)
+	if t.tracker != nil {
+		t.report.attachAccesses(t.tracker.Accesses())
+	}
+	if summary, ok := any(t.collection).(ICollectionSummary); ok {
+		t.report.Collection = summary.Summary()
+	}
+	t.report.RequestID = RequestIDFromContext(ctx)
+	for _, observer := range t.observers.Finish {
+		observer(t.report)
+	}
+	return err
+}
 
-	unblockTypeChan := t.initUnblockTypeChan(t.collectionMeta)
-	resultChan := make(chan *taskResult[CT], len(t.metas)+1) // ensure no-chan-block
-	taskRecord, resultRecord := mapset.NewSet[reflect.Type](), mapset.NewSet[reflect.Type]()
+// execute starts every task once the counter of inputs it waits for drops to zero,
+// the run succeeds when all started tasks have finished and no task is left ready.
+// waits is consumed, tasks with negative waits never start.
+func (t *TaskDagflow[CT]) execute(
+	ctx context.Context, timeout time.Duration, recorder *runRecorder[CT], waits []int32,
+) error {
+	results := make(chan taskResult[CT], len(t.tasks)) // every task sends once: never blocks
 	subCtx, cancel := context.WithCancel(ctx)
 	defer cancel()
-	defer func() {
-		t.timeCost = time.Since(startTime)
-	}()
-	for {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	started, finished := 0, 0
+	start := func(task *taskExecutor[CT]) {
+		started++
+		recorder.TaskStarted(task.Index, time.Now())
+		go task.Execute(subCtx, t.collection, results)
+	}
+	for i, task := range t.tasks {
+		if waits[i] == 0 {
+			start(task)
+		}
+	}
+	// fail waits for the running tasks of a compensable flow, tasks succeeding meanwhile are compensated too
+	fail := func(err error) error {
+		if t.compensable {
+			cancel()
+			for ; finished < started; finished++ {
+				recorder.TaskFinished(<-results)
+			}
+		}
+		return err
+	}
+	for started > finished {
 		select {
 		case <-subCtx.Done():
-			return subCtx.Err()
-		case <-time.After(timeout):
-			return errors.New("task dagflow execution timed out")
-		case unblockType := <-unblockTypeChan:
-			tasks := t.inputToTasks[unblockType]
-			for _, task := range tasks {
-				if task.RemoveAndCheckBlock(unblockType) {
-					taskRecord.Add(task.Meta.OutputType)
-					go task.Execute(subCtx, t.collection, resultChan)
-				}
-			}
-			if taskRecord.Equal(resultRecord) {
-				return nil
-			}
-		case result := <-resultChan:
-			if result == nil {
-				return errors.New("received nil result from task execution")
-			}
-			resultRecord.Add(result.Meta.OutputType)
+			return fail(subCtx.Err())
+		case <-timer.C:
+			return fail(&FlowTimeoutError{FlowName: t.name, Timeout: timeout})
+		case result := <-results:
+			finished++
+			recorder.TaskFinished(result)
 			if result.Err != nil {
-				return fmt.Errorf("task %s failed: %w", result.Meta.Name, result.Err)
+				return fail(&TaskError{TaskName: result.Meta.Name, OutputType: result.Meta.OutputType, Err: result.Err})
+			}
+			for _, dependent := range t.plan.Dependents(result.Index) {
+				waits[dependent]--
+				if waits[dependent] == 0 {
+					start(t.tasks[dependent])
+				}
 			}
-			unblockTypeChan <- result.Meta.OutputType
 		}
 	}
+	return nil
 }
 
 func (t *TaskDagflow[CT]) TimeCost() time.Duration {
@@ -120,3 +206,10 @@ func (t *TaskDagflow[CT]) Tasks() []*taskExecutor[CT] {
 	defer t.lock.Unlock()
 	return t.tasks
 }
+
+// Report returns the report of the last execution, nil if the flow has not been executed
+func (t *TaskDagflow[CT]) Report() *RunReport {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.report
+}
@@ -0,0 +1,116 @@
+package task_dagflow
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// TaskSet holds task registrations, a Factory builds graph snapshots from its TaskSet.
+// A TaskSet is not concurrent-safe: build it in one goroutine, then hand it to Factory.Reload.
+type TaskSet[CT ICollection] struct {
+	outputToTaskMeta map[reflect.Type]*taskMeta[CT]
+	outputToVariants map[reflect.Type]*variantGroup[CT]
+}
+
+func NewTaskSet[CT ICollection]() *TaskSet[CT] {
+	return &TaskSet[CT]{
+		outputToTaskMeta: make(map[reflect.Type]*taskMeta[CT]),
+		outputToVariants: make(map[reflect.Type]*variantGroup[CT]),
+	}
+}
+
+func (s *TaskSet[CT]) RegisterTask(createFunc TaskCreateFunc[CT], options ...TaskOption[CT]) error {
+	meta, err := newTaskMeta(createFunc, options...)
+	if err != nil {
+		return err
+	}
+	if s.outputRegistered(meta.OutputType) {
+		return fmt.Errorf("task with output type %s already registered", meta.OutputType)
+	}
+	s.outputToTaskMeta[meta.OutputType] = meta
+	return nil
+}
+
+// RegisterVariantTasks registers several tasks producing the same output type,
+// selector picks one of them by task name for each collection, e.g. for A/B experiments.
+// Only the chosen variant's inputs are considered when pruning the flow. Options apply to every variant.
+func (s *TaskSet[CT]) RegisterVariantTasks(
+	selector VariantSelector[CT], createFuncs []TaskCreateFunc[CT], options ...TaskOption[CT],
+) error {
+	metas := make([]*taskMeta[CT], 0, len(createFuncs))
+	for _, createFunc := range createFuncs {
+		meta, err := newTaskMeta(createFunc, options...)
+		if err != nil {
+			return err
+		}
+		metas = append(metas, meta)
+	}
+	group, err := newVariantGroup(selector, metas)
+	if err != nil {
+		return err
+	}
+	if s.outputRegistered(group.OutputType) {
+		return fmt.Errorf("task with output type %s already registered", group.OutputType)
+	}
+	s.outputToVariants[group.OutputType] = group
+	return nil
+}
+
+// RegisterFallbackTask registers a fallback producer for the output of an already registered task.
+// Fallbacks run in registration order when the previous producer fails or times out,
+// their inputs must be a subset of the primary task's inputs.
+// A fallback starts once the task of the previous producer returned, even past its timeout,
+// so producers ignoring their ctx never write the output at the same time, unless hedged by WithHedgeDelay.
+func (s *TaskSet[CT]) RegisterFallbackTask(createFunc TaskCreateFunc[CT], options ...TaskOption[CT]) error {
+	meta, err := newTaskMeta(createFunc, options...)
+	if err != nil {
+		return err
+	}
+	if _, isVariant := s.outputToVariants[meta.OutputType]; isVariant {
+		return fmt.Errorf("fallback %s is not supported for variant output type %s", meta.Name, meta.OutputType)
+	}
+	primary, exists := s.outputToTaskMeta[meta.OutputType]
+	if !exists {
+		return fmt.Errorf("no task with output type %s registered for fallback %s", meta.OutputType, meta.Name)
+	}
+	if !meta.InputTypes.IsSubset(primary.InputTypes) {
+		return fmt.Errorf("fallback %s inputs must be a subset of task %s inputs", meta.Name, primary.Name)
+	}
+	primary.Fallbacks = append(primary.Fallbacks, meta)
+	return nil
+}
+
+func (s *TaskSet[CT]) outputRegistered(outputType reflect.Type) bool {
+	_, isTask := s.outputToTaskMeta[outputType]
+	_, isVariant := s.outputToVariants[outputType]
+	return isTask || isVariant
+}
+
+func (s *TaskSet[CT]) empty() bool {
+	return len(s.outputToTaskMeta) == 0 && len(s.outputToVariants) == 0
+}
+
+// metas returns all registered tasks, variants flattened, fallbacks kept inside their primary
+func (s *TaskSet[CT]) metas() []*taskMeta[CT] {
+	metas := make([]*taskMeta[CT], 0, len(s.outputToTaskMeta)+len(s.outputToVariants))
+	for _, meta := range s.outputToTaskMeta {
+		metas = append(metas, meta)
+	}
+	for _, group := range s.outputToVariants {
+		for _, name := range group.Names {
+			metas = append(metas, group.Metas[name])
+		}
+	}
+	return metas
+}
+
+func (s *TaskSet[CT]) clone() *TaskSet[CT] {
+	cloned := NewTaskSet[CT]()
+	for outputType, meta := range s.outputToTaskMeta {
+		cloned.outputToTaskMeta[outputType] = meta.clone()
+	}
+	for outputType, group := range s.outputToVariants {
+		cloned.outputToVariants[outputType] = group.clone()
+	}
+	return cloned
+}
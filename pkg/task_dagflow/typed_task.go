@@ -0,0 +1,159 @@
+package task_dagflow
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+	"time"
+)
+
+// TypedTask is an ITask whose InputTypes() and OutputType() are derived from the type parameters of its builder,
+// NewTask0 to NewTask4. Getters and the setter are passed as method expressions of the collection, e.g.
+//
+//	task_dagflow.NewTask2("PageTask", time.Second,
+//		(*PageCollection).GetProfile, (*PageCollection).GetFeed, (*PageCollection).SetPage,
+//		func(ctx context.Context, profile Profile, feed Feed) (Page, error) { ... })
+//
+// so an accessor not matching the function is a compile error instead of a wrong graph.
+type TypedTask[CT ICollection] struct {
+	name       string
+	timeout    time.Duration
+	inputTypes []reflect.Type
+	outputType reflect.Type
+	execute    func(ctx context.Context, collection CT) error
+	// err is returned by CreateFunc, for type errors the compiler can't catch
+	err error
+}
+
+func newTypedTask[CT ICollection, Out any](
+	name string, timeout time.Duration, inputTypes []reflect.Type, execute func(ctx context.Context, collection CT) error,
+) *TypedTask[CT] {
+	task := &TypedTask[CT]{
+		name:       name,
+		timeout:    timeout,
+		inputTypes: inputTypes,
+		outputType: reflect.TypeFor[Out](),
+		execute:    execute,
+	}
+	for i, inputType := range inputTypes {
+		switch {
+		case inputType == task.outputType:
+			task.err = fmt.Errorf("task %s: %s is both input and output", name, typeName(inputType))
+		case inputType != nil && slices.Index(inputTypes, inputType) < i:
+			task.err = fmt.Errorf("task %s: input %s is declared twice", name, typeName(inputType))
+		}
+	}
+	return task
+}
+
+// setOutput writes the output of a successful fn unless ctx is done: a producer which timed out keeps running
+// in the background while its fallback produces the output, it must not write the collection anymore
+func setOutput[CT ICollection, Out any](ctx context.Context, collection CT, set func(CT, Out), out Out, err error) error {
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	set(collection, out)
+	return nil
+}
+
+// NewTask0 builds a source task without inputs, its InputTypes() is []reflect.Type{nil}
+func NewTask0[CT ICollection, Out any](
+	name string, timeout time.Duration,
+	set func(CT, Out),
+	fn func(ctx context.Context) (Out, error),
+) *TypedTask[CT] {
+	return newTypedTask[CT, Out](name, timeout, []reflect.Type{nil}, func(ctx context.Context, collection CT) error {
+		out, err := fn(ctx)
+		return setOutput(ctx, collection, set, out, err)
+	})
+}
+
+func NewTask1[CT ICollection, A, Out any](
+	name string, timeout time.Duration,
+	getA func(CT) A, set func(CT, Out),
+	fn func(ctx context.Context, a A) (Out, error),
+) *TypedTask[CT] {
+	inputTypes := []reflect.Type{reflect.TypeFor[A]()}
+	return newTypedTask[CT, Out](name, timeout, inputTypes, func(ctx context.Context, collection CT) error {
+		out, err := fn(ctx, getA(collection))
+		return setOutput(ctx, collection, set, out, err)
+	})
+}
+
+func NewTask2[CT ICollection, A, B, Out any](
+	name string, timeout time.Duration,
+	getA func(CT) A, getB func(CT) B, set func(CT, Out),
+	fn func(ctx context.Context, a A, b B) (Out, error),
+) *TypedTask[CT] {
+	inputTypes := []reflect.Type{reflect.TypeFor[A](), reflect.TypeFor[B]()}
+	return newTypedTask[CT, Out](name, timeout, inputTypes, func(ctx context.Context, collection CT) error {
+		out, err := fn(ctx, getA(collection), getB(collection))
+		return setOutput(ctx, collection, set, out, err)
+	})
+}
+
+func NewTask3[CT ICollection, A, B, C, Out any](
+	name string, timeout time.Duration,
+	getA func(CT) A, getB func(CT) B, getC func(CT) C, set func(CT, Out),
+	fn func(ctx context.Context, a A, b B, c C) (Out, error),
+) *TypedTask[CT] {
+	inputTypes := []reflect.Type{reflect.TypeFor[A](), reflect.TypeFor[B](), reflect.TypeFor[C]()}
+	return newTypedTask[CT, Out](name, timeout, inputTypes, func(ctx context.Context, collection CT) error {
+		out, err := fn(ctx, getA(collection), getB(collection), getC(collection))
+		return setOutput(ctx, collection, set, out, err)
+	})
+}
+
+func NewTask4[CT ICollection, A, B, C, D, Out any](
+	name string, timeout time.Duration,
+	getA func(CT) A, getB func(CT) B, getC func(CT) C, getD func(CT) D, set func(CT, Out),
+	fn func(ctx context.Context, a A, b B, c C, d D) (Out, error),
+) *TypedTask[CT] {
+	inputTypes := []reflect.Type{reflect.TypeFor[A](), reflect.TypeFor[B](), reflect.TypeFor[C](), reflect.TypeFor[D]()}
+	return newTypedTask[CT, Out](name, timeout, inputTypes, func(ctx context.Context, collection CT) error {
+		out, err := fn(ctx, getA(collection), getB(collection), getC(collection), getD(collection))
+		return setOutput(ctx, collection, set, out, err)
+	})
+}
+
+// CreateFunc returns a TaskCreateFunc of the task for RegisterTask, it fails if an input type is declared
+// twice or is also the output type. The task is immutable and shared by all flows.
+func (t *TypedTask[CT]) CreateFunc() TaskCreateFunc[CT] {
+	return func() (ITask[CT], error) {
+		if t.err != nil {
+			return nil, t.err
+		}
+		return t, nil
+	}
+}
+
+func (t *TypedTask[CT]) Name() string {
+	return t.name
+}
+
+func (t *TypedTask[CT]) InputTypes() []reflect.Type {
+	return t.inputTypes
+}
+
+func (t *TypedTask[CT]) OutputType() reflect.Type {
+	return t.outputType
+}
+
+func (t *TypedTask[CT]) Timeout() time.Duration {
+	return t.timeout
+}
+
+// Stateless is true: the task is created once and shared by all flows, see IStatelessTask
+func (t *TypedTask[CT]) Stateless() bool {
+	return true
+}
+
+// Execute reads inputs with the getters, calls the function and writes its output with the setter
+// when it succeeds and ctx is not done
+func (t *TypedTask[CT]) Execute(ctx context.Context, collection CT) error {
+	return t.execute(ctx, collection)
+}
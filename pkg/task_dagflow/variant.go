@@ -0,0 +1,69 @@
+package task_dagflow
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// VariantSelector picks, by task name, which variant produces the output in the run of this collection,
+// e.g. by user bucket or feature flag
+type VariantSelector[CT ICollection] func(collection CT) string
+
+// variantGroup holds several tasks registered for one output type
+type variantGroup[CT ICollection] struct {
+	OutputType reflect.Type
+	Selector   VariantSelector[CT]
+	Names      []string
+	Metas      map[string]*taskMeta[CT]
+}
+
+func newVariantGroup[CT ICollection](selector VariantSelector[CT], metas []*taskMeta[CT]) (*variantGroup[CT], error) {
+	if selector == nil {
+		return nil, fmt.Errorf("variant selector must not be nil")
+	}
+	if len(metas) == 0 {
+		return nil, fmt.Errorf("at least one variant task is required")
+	}
+	group := &variantGroup[CT]{
+		OutputType: metas[0].OutputType,
+		Selector:   selector,
+		Names:      make([]string, 0, len(metas)),
+		Metas:      make(map[string]*taskMeta[CT], len(metas)),
+	}
+	for _, meta := range metas {
+		if meta.OutputType != group.OutputType {
+			return nil, fmt.Errorf("variant %s output type %s differs from %s",
+				meta.Name, meta.OutputType, group.OutputType)
+		}
+		if _, exists := group.Metas[meta.Name]; exists {
+			return nil, fmt.Errorf("variant %s registered twice for output type %s", meta.Name, group.OutputType)
+		}
+		meta.IsVariant = true
+		group.Names = append(group.Names, meta.Name)
+		group.Metas[meta.Name] = meta
+	}
+	return group, nil
+}
+
+func (g *variantGroup[CT]) Select(collection CT) (*taskMeta[CT], error) {
+	name := g.Selector(collection)
+	meta, exists := g.Metas[name]
+	if !exists {
+		return nil, fmt.Errorf("variant %q not registered for output type %s, candidates: %v",
+			name, g.OutputType, g.Names)
+	}
+	return meta, nil
+}
+
+func (g *variantGroup[CT]) clone() *variantGroup[CT] {
+	cloned := &variantGroup[CT]{
+		OutputType: g.OutputType,
+		Selector:   g.Selector,
+		Names:      append([]string(nil), g.Names...),
+		Metas:      make(map[string]*taskMeta[CT], len(g.Metas)),
+	}
+	for name, meta := range g.Metas {
+		cloned.Metas[name] = meta.clone()
+	}
+	return cloned
+}
@@ -0,0 +1,20 @@
+package tools
+
+// Bitset is a fixed size set of small non-negative integers, e.g. indexes of a slice
+type Bitset []uint64
+
+func NewBitset(size int) Bitset {
+	return make(Bitset, (size+63)/64)
+}
+
+func (b Bitset) Set(i int) {
+	b[i/64] |= 1 << (uint(i) % 64)
+}
+
+func (b Bitset) Has(i int) bool {
+	return b[i/64]&(1<<(uint(i)%64)) != 0
+}
+
+func (b Bitset) Clear() {
+	clear(b)
+}
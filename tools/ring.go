@@ -0,0 +1,113 @@
+package tools
+
+import (
+	"sync"
+)
+
+var (
+	_ RingBuffer[any] = (*ringBuffer[any])(nil)
+	_ RingBuffer[any] = (*concurrentRingBuffer[any])(nil)
+)
+
+// RingBuffer keeps the last Capacity() items, the oldest item is overwritten when full
+type RingBuffer[T any] interface {
+	Push(item T)
+	// ToSlice returns items from the oldest to the newest
+	ToSlice() []T
+	Size() int
+	Capacity() int
+	Clear()
+}
+
+type ringBuffer[T any] struct {
+	items []T
+	start int
+	size  int
+}
+
+func NewRingBuffer[T any](capacity int) RingBuffer[T] {
+	if capacity <= 0 {
+		capacity = 1
+	}
+	return &ringBuffer[T]{
+		items: make([]T, capacity),
+		start: 0,
+		size:  0,
+	}
+}
+
+func (r *ringBuffer[T]) Push(item T) {
+	if r.size < len(r.items) {
+		r.items[(r.start+r.size)%len(r.items)] = item
+		r.size++
+		return
+	}
+	r.items[r.start] = item
+	r.start = (r.start + 1) % len(r.items)
+}
+
+func (r *ringBuffer[T]) ToSlice() []T {
+	result := make([]T, 0, r.size)
+	for i := 0; i < r.size; i++ {
+		result = append(result, r.items[(r.start+i)%len(r.items)])
+	}
+	return result
+}
+
+func (r *ringBuffer[T]) Size() int {
+	return r.size
+}
+
+func (r *ringBuffer[T]) Capacity() int {
+	return len(r.items)
+}
+
+func (r *ringBuffer[T]) Clear() {
+	var zero T
+	for i := range r.items {
+		r.items[i] = zero
+	}
+	r.start = 0
+	r.size = 0
+}
+
+type concurrentRingBuffer[T any] struct {
+	ringBuffer[T]
+	rwLock sync.RWMutex
+}
+
+func NewConcurrentRingBuffer[T any](capacity int) RingBuffer[T] {
+	return &concurrentRingBuffer[T]{
+		ringBuffer: *NewRingBuffer[T](capacity).(*ringBuffer[T]),
+	}
+}
+
+func (cr *concurrentRingBuffer[T]) Push(item T) {
+	cr.rwLock.Lock()
+	defer cr.rwLock.Unlock()
+	cr.ringBuffer.Push(item)
+}
+
+func (cr *concurrentRingBuffer[T]) ToSlice() []T {
+	cr.rwLock.RLock()
+	defer cr.rwLock.RUnlock()
+	return cr.ringBuffer.ToSlice()
+}
+
+func (cr *concurrentRingBuffer[T]) Size() int {
+	cr.rwLock.RLock()
+	defer cr.rwLock.RUnlock()
+	return cr.ringBuffer.Size()
+}
+
+func (cr *concurrentRingBuffer[T]) Capacity() int {
+	cr.rwLock.RLock()
+	defer cr.rwLock.RUnlock()
+	return cr.ringBuffer.Capacity()
+}
+
+func (cr *concurrentRingBuffer[T]) Clear() {
+	cr.rwLock.Lock()
+	defer cr.rwLock.Unlock()
+	cr.ringBuffer.Clear()
+}